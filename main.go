@@ -2,7 +2,9 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -10,8 +12,11 @@ import (
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober"
 	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport"
 )
 
@@ -24,6 +29,8 @@ func init() {
 	clientgoscheme.AddToScheme(scheme) //nolint: errcheck
 
 	v1alpha1.AddToScheme(scheme) //nolint: errcheck
+
+	kosmosv1alpha1.AddToScheme(scheme) //nolint: errcheck
 }
 
 func main() {
@@ -33,20 +40,192 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeFailureThreshold int
+	var probeSuccessThreshold int
 	var probePeriodSeconds int
+	var probeTimeout time.Duration
+	var probeConcurrency int
+	var probeType string
+	var icmpMode string
+	var icmpSharedSocket bool
+	var icmpCount int
+	var icmpInterval time.Duration
+	var icmpMaxLossPercent int
+	var icmpMaxAvgRTT time.Duration
+	var degradedMaxLatency time.Duration
+	var degradedMaxLossPercent int
+	var degradedThreshold int
+	var degradedRecoveryThreshold int
+	var httpScheme string
+	var httpPath string
+	var httpPort int
+	var httpHeaders string
+	var httpExpectedStatus string
+	var httpExpectedBody string
+	var grpcPort int
+	var grpcService string
+	var statusReportPeriod time.Duration
+	var enableProbePolicy bool
+	var enableProbeStatus bool
+	var markEndpointSlices bool
+	var restoreEndpointSlices bool
+	var targetSource string
 
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false, ""+
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.IntVar(&probeFailureThreshold, "probe-failure-threshold", 3, "Minimum consecutive failure for the probe to be considered failed.")
+	flag.IntVar(&probeSuccessThreshold, "probe-success-threshold", 1,
+		"Minimum consecutive successes for the probe to be considered successful after having failed.")
 	flag.IntVar(&probePeriodSeconds, "probe-period-seconds", 5, "How often (in seconds) to perform the probe.")
+	flag.DurationVar(&probeTimeout, "probe-timeout", time.Second, "Timeout of a single probe.")
+	flag.IntVar(&probeConcurrency, "probe-concurrency", 100, "Maximum number of probes running at the same time across all ServiceImports.")
+	flag.StringVar(&probeType, "probe-type", string(prober.ICMPProbe), fmt.Sprintf("The default way addresses are probed, one of %q.",
+		prober.RegisteredTypes()))
+	flag.StringVar(&icmpMode, "icmp-mode", string(prober.ICMPModeAuto), fmt.Sprintf("The ICMP socket mode, one of %q, %q, %q. "+
+		"%q selects unprivileged mode if net.ipv4.ping_group_range allows it.",
+		prober.ICMPModeAuto, prober.ICMPModePrivileged, prober.ICMPModeUnprivileged, prober.ICMPModeAuto))
+	flag.BoolVar(&icmpSharedSocket, "icmp-shared-socket", true, "Send all ICMP echo requests over one socket per IP version "+
+		"kept open for the lifetime of the process, instead of opening a socket per probe.")
+	flag.IntVar(&icmpCount, "probe-icmp-count", 1, "Default number of echo requests sent by the icmp probe.")
+	flag.DurationVar(&icmpInterval, "probe-icmp-interval", 100*time.Millisecond, "Default interval between the echo requests of the icmp probe.")
+	flag.IntVar(&icmpMaxLossPercent, "probe-icmp-max-loss-percent", 50,
+		"Default highest percentage of lost echo requests for the icmp probe to succeed.")
+	flag.DurationVar(&icmpMaxAvgRTT, "probe-icmp-max-avg-rtt", 0,
+		"Default highest average round trip time for the icmp probe to succeed, 0 means no limit.")
+	flag.DurationVar(&degradedMaxLatency, "probe-degraded-max-latency", 0, "Default highest latency of a successful probe "+
+		"before the address is considered degraded, 0 means no limit.")
+	flag.IntVar(&degradedMaxLossPercent, "probe-degraded-max-loss-percent", 100, "Default highest packet loss of a "+
+		"successful probe before the address is considered degraded, 100 means no limit.")
+	flag.IntVar(&degradedThreshold, "probe-degraded-threshold", 3,
+		"Minimum consecutive probes exceeding the degraded budget for the address to be considered degraded.")
+	flag.IntVar(&degradedRecoveryThreshold, "probe-degraded-recovery-threshold", 1,
+		"Minimum consecutive probes within the degraded budget for a degraded address to be considered healthy again.")
+	flag.StringVar(&httpScheme, "probe-http-scheme", "http", "Default scheme of the http probe, http or https.")
+	flag.StringVar(&httpPath, "probe-http-path", "/", "Default path of the http probe.")
+	flag.IntVar(&httpPort, "probe-http-port", 0, "Default port of the http probe, 0 means the first TCP port of the ServiceImport.")
+	flag.StringVar(&httpHeaders, "probe-http-headers", "", `Default headers of the http probe as a JSON object, e.g. {"Host":"example.com"}.`)
+	flag.StringVar(&httpExpectedStatus, "probe-http-expected-status", "200-399", "Default range of status codes considered successful by the http probe.")
+	flag.StringVar(&httpExpectedBody, "probe-http-expected-body", "", "Default substring the http probe response body must contain.")
+	flag.IntVar(&grpcPort, "probe-grpc-port", 0, "Default port of the grpc probe, 0 means the first TCP port of the ServiceImport.")
+	flag.StringVar(&grpcService, "probe-grpc-service", "", "Default service name sent in the grpc health check request.")
+	flag.DurationVar(&statusReportPeriod, "probe-status-report-period", 0, "How often the address statuses, "+
+		"including the last probe times, are published while no address changes its result, 0 publishes them on changes only. "+
+		"Every report updates the ServiceImport annotations and the EndpointProbeStatus.")
+	flag.BoolVar(&enableProbePolicy, "enable-probe-policy", false,
+		"Apply the ProbePolicies selecting a ServiceImport to its probe, requires the ProbePolicy CRD.")
+	flag.BoolVar(&enableProbeStatus, "enable-probe-status", false,
+		"Maintain an EndpointProbeStatus owned by every probed ServiceImport, requires the EndpointProbeStatus CRD.")
+	flag.BoolVar(&markEndpointSlices, "mark-endpointslices", false, "Mark the endpoints of unreachable addresses "+
+		"in the EndpointSlices of a ServiceImport (multicluster.kubernetes.io/service-name label) not ready and not serving.")
+	flag.BoolVar(&restoreEndpointSlices, "restore-endpointslices", false, "Mark the endpoints marked not ready by a "+
+		"previous run with --mark-endpointslices ready again at startup. Ignored with --mark-endpointslices.")
+	flag.StringVar(&targetSource, "target-source", string(prober.TargetSourceAnnotation), fmt.Sprintf("Where the probed "+
+		"addresses of a ServiceImport come from, %q for the %s annotation or %q for the endpoints of its EndpointSlices.",
+		prober.TargetSourceAnnotation, prober.ServiceImportEPSAddr, prober.TargetSourceEndpointSlice))
 	flag.Parse()
 
+	if probeFailureThreshold < 1 || probePeriodSeconds < 1 {
+		klog.ErrorS(nil, "Probe failure threshold and period seconds must be at least 1",
+			"probeFailureThreshold", probeFailureThreshold, "probePeriodSeconds", probePeriodSeconds)
+		os.Exit(-1)
+	}
+
+	if probeTimeout <= 0 || probeTimeout > time.Duration(probePeriodSeconds)*time.Second {
+		klog.ErrorS(nil, "Probe timeout must be positive and not exceed the probe period", "probeTimeout", probeTimeout)
+		os.Exit(-1)
+	}
+
+	if probeSuccessThreshold < 1 {
+		klog.ErrorS(nil, "Probe success threshold must be at least 1", "probeSuccessThreshold", probeSuccessThreshold)
+		os.Exit(-1)
+	}
+
+	if statusReportPeriod < 0 {
+		klog.ErrorS(nil, "Probe status report period must not be negative", "statusReportPeriod", statusReportPeriod)
+		os.Exit(-1)
+	}
+
+	if probeConcurrency < 1 {
+		klog.ErrorS(nil, "Probe concurrency must be at least 1", "probeConcurrency", probeConcurrency)
+		os.Exit(-1)
+	}
+
+	if !prober.IsRegistered(prober.ProbeType(probeType)) {
+		klog.ErrorS(nil, "Unsupported probe type", "probeType", probeType)
+		os.Exit(-1)
+	}
+
+	resolvedTargetSource, err := prober.ParseTargetSource(targetSource)
+	if err != nil {
+		klog.ErrorS(err, "Invalid target source")
+		os.Exit(-1)
+	}
+
+	resolvedICMPMode, err := prober.ResolveICMPMode(prober.ICMPMode(icmpMode))
+	if err != nil {
+		klog.ErrorS(err, "Invalid icmp mode")
+		os.Exit(-1)
+	}
+
+	icmpConfig := prober.ICMPProbeConfig{
+		Count:          icmpCount,
+		Interval:       icmpInterval,
+		MaxLossPercent: icmpMaxLossPercent,
+		MaxAvgRTT:      icmpMaxAvgRTT,
+	}
+	if err := icmpConfig.Validate(); err != nil {
+		klog.ErrorS(err, "Invalid icmp probe configuration")
+		os.Exit(-1)
+	}
+
+	degradedBudget := prober.DegradedBudget{
+		MaxLatency:        degradedMaxLatency,
+		MaxLossPercent:    degradedMaxLossPercent,
+		Threshold:         degradedThreshold,
+		RecoveryThreshold: degradedRecoveryThreshold,
+	}
+	if err := degradedBudget.Validate(); err != nil {
+		klog.ErrorS(err, "Invalid degraded budget")
+		os.Exit(-1)
+	}
+
+	headers, err := prober.ParseHTTPHeaders(httpHeaders)
+	if err != nil {
+		klog.ErrorS(err, "Invalid http probe headers")
+		os.Exit(-1)
+	}
+	expectedStatus, err := prober.ParseStatusRange(httpExpectedStatus)
+	if err != nil {
+		klog.ErrorS(err, "Invalid http probe expected status")
+		os.Exit(-1)
+	}
+	httpConfig := prober.HTTPProbeConfig{
+		Scheme:         httpScheme,
+		Path:           httpPath,
+		Port:           int32(httpPort),
+		Headers:        headers,
+		ExpectedStatus: expectedStatus,
+		ExpectedBody:   httpExpectedBody,
+	}
+	if err := httpConfig.Validate(); err != nil {
+		klog.ErrorS(err, "Invalid http probe configuration")
+		os.Exit(-1)
+	}
+	grpcConfig := prober.GRPCProbeConfig{
+		Port:    int32(grpcPort),
+		Service: grpcService,
+	}
+	if err := grpcConfig.Validate(); err != nil {
+		klog.ErrorS(err, "Invalid grpc probe configuration")
+		os.Exit(-1)
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:           scheme,
 		Logger:           setupLog,
+		Metrics:          metricsserver.Options{BindAddress: metricsAddr},
 		LeaderElection:   enableLeaderElection,
 		LeaderElectionID: "eps-probe-plugin",
 	})
@@ -55,7 +234,28 @@ func main() {
 		os.Exit(-1)
 	}
 
-	c := serviceimport.NewController(mgr.GetClient(), probePeriodSeconds, probeFailureThreshold)
+	c := serviceimport.NewController(mgr.GetClient(), mgr.GetEventRecorderFor("eps-probe-plugin"), prober.ProbeSpec{
+		PeriodSeconds:      probePeriodSeconds,
+		Timeout:            probeTimeout,
+		FailureThreshold:   probeFailureThreshold,
+		SuccessThreshold:   probeSuccessThreshold,
+		Type:               prober.ProbeType(probeType),
+		ICMPMode:           resolvedICMPMode,
+		ICMPSharedSocket:   icmpSharedSocket,
+		ICMP:               icmpConfig,
+		HTTP:               httpConfig,
+		GRPC:               grpcConfig,
+		Degraded:           degradedBudget,
+		StatusReportPeriod: statusReportPeriod,
+	}, serviceimport.Options{
+		ProbeConcurrency:      probeConcurrency,
+		EnableProbePolicy:     enableProbePolicy,
+		EnableProbeStatus:     enableProbeStatus,
+		APIReader:             mgr.GetAPIReader(),
+		MarkEndpointSlices:    markEndpointSlices,
+		RestoreEndpointSlices: restoreEndpointSlices,
+		TargetSource:          resolvedTargetSource,
+	})
 
 	if err := (&serviceimport.Reconciler{Controller: c}).SetupWithManager(mgr); err != nil {
 		klog.ErrorS(err, "Could not setup with manager")
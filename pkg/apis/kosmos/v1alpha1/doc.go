@@ -0,0 +1,4 @@
+// Package v1alpha1 contains the v1alpha1 API of the kosmos.io group used by the eps-probe-plugin.
+// +k8s:deepcopy-gen=package
+// +groupName=kosmos.io
+package v1alpha1
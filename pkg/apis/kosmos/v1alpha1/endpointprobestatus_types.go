@@ -0,0 +1,114 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// EndpointProbeStatusAllReachable is true when no address of the ServiceImport is unreachable.
+	EndpointProbeStatusAllReachable = "AllReachable"
+	// EndpointProbeStatusDegraded is true when some, but not all, addresses of the ServiceImport are unreachable,
+	// or when reachable addresses exceed the latency or loss budget.
+	EndpointProbeStatusDegraded = "Degraded"
+)
+
+// +kubebuilder:resource:scope=Namespaced,shortName=epst
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="ALL-REACHABLE",type=string,JSONPath=`.status.conditions[?(@.type=="AllReachable")].status`
+// +kubebuilder:printcolumn:name="DEGRADED",type=string,JSONPath=`.status.conditions[?(@.type=="Degraded")].status`
+// +kubebuilder:printcolumn:name="AGE",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// EndpointProbeStatus is the probe status of the addresses of a ServiceImport. It has the name and
+// namespace of the ServiceImport and is owned by it, so it is garbage collected together with it.
+type EndpointProbeStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Status is the most recently observed probe status of the ServiceImport.
+	// +optional
+	Status EndpointProbeStatusStatus `json:"status,omitempty"`
+}
+
+// EndpointProbeStatusStatus is the observed probe status of the addresses of a ServiceImport.
+type EndpointProbeStatusStatus struct {
+	// Conditions are the AllReachable and Degraded conditions of the ServiceImport.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// UnreachableAddresses are the addresses currently published as unreachable, sorted.
+	// +optional
+	UnreachableAddresses []string `json:"unreachableAddresses,omitempty"`
+
+	// DegradedAddresses are the reachable addresses currently exceeding the latency or loss budget, sorted.
+	// +optional
+	DegradedAddresses []string `json:"degradedAddresses,omitempty"`
+
+	// Addresses are the probe statuses of the probed addresses, sorted by address.
+	// +optional
+	Addresses []AddressProbeStatus `json:"addresses,omitempty"`
+}
+
+// AddressProbeStatus is the probe status of a single address.
+type AddressProbeStatus struct {
+	// Address is the probed address.
+	Address string `json:"address"`
+
+	// Reachable is false if the address is considered unreachable.
+	Reachable bool `json:"reachable"`
+
+	// Suppressed is true if the address is unreachable but not listed in UnreachableAddresses, because
+	// too many addresses of the ServiceImport are unreachable.
+	// +optional
+	Suppressed bool `json:"suppressed,omitempty"`
+
+	// Degraded is true if the address is reachable but exceeds the latency or loss budget.
+	// +optional
+	Degraded bool `json:"degraded,omitempty"`
+
+	// LastResult is the result of the last probe, one of success, degraded, failure or unknown.
+	// +optional
+	LastResult string `json:"lastResult,omitempty"`
+
+	// ConsecutiveSuccesses is the number of consecutive successful or degraded probes.
+	// +optional
+	ConsecutiveSuccesses int32 `json:"consecutiveSuccesses,omitempty"`
+
+	// ConsecutiveFailures is the number of consecutive failed probes.
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
+	// LastTransitionTime is when Reachable last changed.
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// LastDegradedTransitionTime is when Degraded last changed.
+	// +optional
+	LastDegradedTransitionTime *metav1.Time `json:"lastDegradedTransitionTime,omitempty"`
+
+	// LastProbeTime is when the address was last probed.
+	// +optional
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+
+	// LastRTT is the latency of the last successful or degraded probe.
+	// +optional
+	LastRTT *metav1.Duration `json:"lastRTT,omitempty"`
+
+	// PacketLossPercent is the packet loss of the last probe, only set by probes sending several packets.
+	// +optional
+	PacketLossPercent *int32 `json:"packetLossPercent,omitempty"`
+
+	// Reason describes why the last probe did not succeed or was degraded.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// EndpointProbeStatusList contains a list of EndpointProbeStatus.
+type EndpointProbeStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []EndpointProbeStatus `json:"items"`
+}
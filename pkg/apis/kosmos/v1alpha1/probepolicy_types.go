@@ -0,0 +1,129 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:resource:scope=Cluster,shortName=pp
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="TYPE",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="PRIORITY",type=integer,JSONPath=`.spec.priority`
+// +kubebuilder:printcolumn:name="AGE",type=date,JSONPath=`.metadata.creationTimestamp`
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ProbePolicy defines how the ServiceImports it selects are probed.
+type ProbePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the specification of the probe policy.
+	// +required
+	Spec ProbePolicySpec `json:"spec"`
+}
+
+// ProbePolicySpec selects ServiceImports and defines the probe configuration applied to them.
+// Unset fields fall back to the global defaults of the plugin, and probe annotations on a
+// ServiceImport take precedence over the policy.
+type ProbePolicySpec struct {
+	// NamespaceSelector selects the namespaces of the ServiceImports. An empty or nil selector
+	// selects all namespaces.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// ServiceImportSelector selects ServiceImports by their labels. An empty or nil selector
+	// selects all ServiceImports.
+	// +optional
+	ServiceImportSelector *metav1.LabelSelector `json:"serviceImportSelector,omitempty"`
+
+	// Priority decides which policy applies when several policies select the same ServiceImport.
+	// The policy with the highest priority wins, ties are broken by the lexically smallest name.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Type is the probe type, e.g. icmp, tcp, http or grpc.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Ports to probe instead of the TCP ports of the ServiceImport. Only used by probe types
+	// which connect to a port.
+	// +optional
+	Ports []int32 `json:"ports,omitempty"`
+
+	// PeriodSeconds is how often (in seconds) to perform the probe.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// Timeout of a single probe.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// FailureThreshold is the minimum consecutive failures for an address to be considered unreachable.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+
+	// SuccessThreshold is the minimum consecutive successes for an unreachable address to be
+	// considered reachable again.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+
+	// Guards protect against marking addresses unreachable because of problems on the prober side.
+	// +optional
+	Guards *ProbeGuards `json:"guards,omitempty"`
+
+	// Degraded is the latency and loss budget of the addresses which respond to their probes.
+	// +optional
+	Degraded *DegradedBudget `json:"degraded,omitempty"`
+}
+
+// ProbeGuards limits what a probe round is allowed to mark unreachable.
+type ProbeGuards struct {
+	// MaxUnreachablePercent is the maximum percentage of addresses of a ServiceImport that may be
+	// marked unreachable. If a probe round exceeds it, the previously published unreachable addresses are
+	// kept, since losing that many addresses at once more likely points to a problem of the prober itself.
+	// Degraded addresses and address statuses are still published, suppressed addresses are flagged there.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MaxUnreachablePercent *int32 `json:"maxUnreachablePercent,omitempty"`
+}
+
+// DegradedBudget defines when an address which responds to its probes is considered degraded.
+// Degraded addresses stay reachable, they are published separately so consumers can deprioritise them.
+type DegradedBudget struct {
+	// MaxLatency is the highest latency of a successful probe within the budget. Unset or zero
+	// means no limit.
+	// +optional
+	MaxLatency *metav1.Duration `json:"maxLatency,omitempty"`
+
+	// MaxLossPercent is the highest packet loss of a successful probe within the budget. Only
+	// probes sending several packets report a loss.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	MaxLossPercent *int32 `json:"maxLossPercent,omitempty"`
+
+	// Threshold is the minimum consecutive probes exceeding the budget for an address to be
+	// considered degraded.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Threshold *int32 `json:"threshold,omitempty"`
+
+	// RecoveryThreshold is the minimum consecutive probes within the budget for a degraded address
+	// to be considered healthy again.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RecoveryThreshold *int32 `json:"recoveryThreshold,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ProbePolicyList contains a list of ProbePolicy.
+type ProbePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ProbePolicy `json:"items"`
+}
@@ -0,0 +1,104 @@
+package prober
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+const (
+	// ServiceImportDegradedMaxLatency overrides the highest probe latency within the degraded budget, e.g. "200ms".
+	ServiceImportDegradedMaxLatency = "kosmos.io/probe-degraded-max-latency"
+
+	// ServiceImportDegradedMaxLossPercent overrides the highest packet loss within the degraded budget.
+	ServiceImportDegradedMaxLossPercent = "kosmos.io/probe-degraded-max-loss-percent"
+
+	// ServiceImportDegradedThreshold overrides the minimum consecutive probes exceeding the budget for an
+	// address to be considered degraded.
+	ServiceImportDegradedThreshold = "kosmos.io/probe-degraded-threshold"
+
+	// ServiceImportDegradedRecoveryThreshold overrides the minimum consecutive probes within the budget for
+	// a degraded address to be considered healthy again.
+	ServiceImportDegradedRecoveryThreshold = "kosmos.io/probe-degraded-recovery-threshold"
+)
+
+// DegradedBudget describes when an address which responds to its probes is considered degraded.
+type DegradedBudget struct {
+	// MaxLatency is the highest latency of a successful probe within the budget, zero means no limit.
+	MaxLatency time.Duration
+	// MaxLossPercent is the highest packet loss of a successful probe within the budget. Only probes
+	// sending several packets report a loss.
+	MaxLossPercent int
+	// Threshold is the minimum consecutive probes exceeding the budget for an address to be considered degraded.
+	Threshold int
+	// RecoveryThreshold is the minimum consecutive probes within the budget for a degraded address to be
+	// considered healthy again.
+	RecoveryThreshold int
+}
+
+// Validate checks whether the degraded budget is usable.
+func (b *DegradedBudget) Validate() error {
+	if b.MaxLatency < 0 {
+		return fmt.Errorf("degraded max latency must not be negative")
+	}
+	if b.MaxLossPercent < 0 || b.MaxLossPercent > 100 {
+		return fmt.Errorf("degraded max loss percent must be between 0 and 100")
+	}
+	if b.Threshold < 1 || b.RecoveryThreshold < 1 {
+		return fmt.Errorf("degraded thresholds must be at least 1")
+	}
+	return nil
+}
+
+// exceeded returns whether the result of a successful probe exceeds the budget, and why.
+func (b *DegradedBudget) exceeded(r ProbeResult) (bool, string) {
+	if b.MaxLatency > 0 && r.Latency > b.MaxLatency {
+		return true, fmt.Sprintf("latency %s exceeds the budget of %s", r.Latency, b.MaxLatency)
+	}
+	if r.Packets != nil && r.Packets.LossPercent > float64(b.MaxLossPercent) {
+		return true, fmt.Sprintf("packet loss %.0f%% exceeds the budget of %d%%", r.Packets.LossPercent, b.MaxLossPercent)
+	}
+	return false, ""
+}
+
+// resolveDegradedBudget overrides the budget with the degraded annotations of the ServiceImport.
+func resolveDegradedBudget(budget DegradedBudget, svcImport *v1alpha1.ServiceImport) (*DegradedBudget, error) {
+	b := budget
+
+	annotations := svcImport.Annotations
+	if v, ok := annotations[ServiceImportDegradedMaxLatency]; ok {
+		latency, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid degraded max latency %q", v)
+		}
+		b.MaxLatency = latency
+	}
+	if v, ok := annotations[ServiceImportDegradedMaxLossPercent]; ok {
+		loss, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid degraded max loss percent %q", v)
+		}
+		b.MaxLossPercent = loss
+	}
+	if v, ok := annotations[ServiceImportDegradedThreshold]; ok {
+		threshold, err := parsePositiveInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid degraded threshold %q", v)
+		}
+		b.Threshold = threshold
+	}
+	if v, ok := annotations[ServiceImportDegradedRecoveryThreshold]; ok {
+		threshold, err := parsePositiveInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid degraded recovery threshold %q", v)
+		}
+		b.RecoveryThreshold = threshold
+	}
+
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
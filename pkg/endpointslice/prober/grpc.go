@@ -0,0 +1,201 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+func init() {
+	MustRegister(GRPCProbe, newGRPCProber)
+}
+
+const (
+	ServiceImportGRPCPort    = "kosmos.io/probe-grpc-port"
+	ServiceImportGRPCService = "kosmos.io/probe-grpc-service"
+)
+
+// GRPCProbeConfig describes how the gRPC health checking probe is performed.
+type GRPCProbeConfig struct {
+	// Port to access on the address. Zero means the first TCP port to probe.
+	Port int32
+	// Service is the name of the service to check, empty means the overall health of the server.
+	Service string
+}
+
+// Validate checks whether the gRPC probe configuration is usable.
+func (c *GRPCProbeConfig) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid grpc port %d", c.Port)
+	}
+	return nil
+}
+
+// resolveGRPCProbeConfig overrides the defaults with the gRPC probe annotations of the ServiceImport.
+func resolveGRPCProbeConfig(defaults GRPCProbeConfig, svcImport *v1alpha1.ServiceImport) (*GRPCProbeConfig, error) {
+	c := defaults
+
+	annotations := svcImport.Annotations
+	if v, ok := annotations[ServiceImportGRPCPort]; ok {
+		port, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc port %q", v)
+		}
+		c.Port = int32(port)
+	}
+	if v, ok := annotations[ServiceImportGRPCService]; ok {
+		c.Service = v
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// grpcProber calls grpc.health.v1.Health/Check on the address.
+type grpcProber struct {
+	service string
+	port    int32
+	timeout time.Duration
+	// conns are the connections to the probed addresses.
+	conns *grpcConnPool
+}
+
+func newGRPCProber(config *Config) (Prober, error) {
+	grpcConfig, err := resolveGRPCProbeConfig(config.GRPC, config.ServiceImport)
+	if err != nil {
+		return nil, err
+	}
+
+	port := grpcConfig.Port
+	if port == 0 {
+		if len(config.Ports) == 0 {
+			return nil, fmt.Errorf("no grpc port configured and no TCP ports found in serviceImport")
+		}
+		port = config.Ports[0]
+	}
+	return &grpcProber{service: grpcConfig.Service, port: port, timeout: config.Timeout, conns: sharedGRPCConns}, nil
+}
+
+func (p *grpcProber) Probe(ctx context.Context, address string) (ProbeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	target := net.JoinHostPort(address, strconv.Itoa(int(p.port)))
+	start := time.Now()
+	status, err := p.check(ctx, target)
+	if err != nil {
+		return ProbeResult{Result: results.Failure, Detail: err.Error()}, nil
+	}
+
+	switch status {
+	case healthpb.HealthCheckResponse_SERVING:
+		return ProbeResult{Result: results.Success, Latency: time.Since(start)}, nil
+	case healthpb.HealthCheckResponse_NOT_SERVING:
+		return ProbeResult{Result: results.Failure, Detail: fmt.Sprintf("health status is %s", status)}, nil
+	default:
+		return ProbeResult{Result: results.Unknown, Detail: fmt.Sprintf("health status is %s", status)}, nil
+	}
+}
+
+// check calls the health service of the target over the pooled connection. The connection is closed if the
+// target could not be reached, so the next probe dials again instead of waiting out the reconnect backoff of
+// the connection.
+func (p *grpcProber) check(ctx context.Context, target string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	conn, err := p.conns.get(target)
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: p.service})
+	if err != nil {
+		if code := status.Code(err); code == codes.Unavailable || code == codes.DeadlineExceeded {
+			p.conns.discard(target, conn)
+		}
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	return resp.GetStatus(), nil
+}
+
+// grpcConnIdleTimeout is how long a connection is kept open without being used by a probe.
+const grpcConnIdleTimeout = 5 * time.Minute
+
+// sharedGRPCConns are the connections of all gRPC probes of the process.
+var sharedGRPCConns = newGRPCConnPool(grpcConnIdleTimeout)
+
+// grpcConnPool keeps one connection per target open between probes, instead of a TCP and HTTP/2 handshake
+// per probe. Connections which have not been used for the idle timeout are closed.
+type grpcConnPool struct {
+	idleTimeout time.Duration
+
+	// guards conns and lastSweep
+	lock  sync.Mutex
+	conns map[string]*pooledGRPCConn
+	// lastSweep is when idle connections were last closed.
+	lastSweep time.Time
+}
+
+type pooledGRPCConn struct {
+	conn     *grpc.ClientConn
+	lastUsed time.Time
+}
+
+func newGRPCConnPool(idleTimeout time.Duration) *grpcConnPool {
+	return &grpcConnPool{idleTimeout: idleTimeout, conns: map[string]*pooledGRPCConn{}, lastSweep: time.Now()}
+}
+
+// get returns the connection to the target, dialing it if there is none.
+func (p *grpcConnPool) get(target string) (*grpc.ClientConn, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.lastSweep) >= p.idleTimeout {
+		p.closeIdle(now)
+	}
+
+	if c, ok := p.conns[target]; ok {
+		c.lastUsed = now
+		return c.conn, nil
+	}
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	p.conns[target] = &pooledGRPCConn{conn: conn, lastUsed: now}
+	return conn, nil
+}
+
+// discard closes the connection and removes it from the pool, unless it has been replaced meanwhile.
+func (p *grpcConnPool) discard(target string, conn *grpc.ClientConn) {
+	p.lock.Lock()
+	if c, ok := p.conns[target]; ok && c.conn == conn {
+		delete(p.conns, target)
+	}
+	p.lock.Unlock()
+	conn.Close() //nolint: errcheck
+}
+
+// closeIdle closes the connections not used for the idle timeout, p.lock must be held.
+func (p *grpcConnPool) closeIdle(now time.Time) {
+	for target, c := range p.conns {
+		if now.Sub(c.lastUsed) >= p.idleTimeout {
+			delete(p.conns, target)
+			c.conn.Close() //nolint: errcheck
+		}
+	}
+	p.lastSweep = now
+}
@@ -0,0 +1,149 @@
+package prober
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+// startHealthServer serves the gRPC health service on a local port and returns the port.
+func startHealthServer(t *testing.T) (*health.Server, *grpc.Server, int32) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthServer := health.NewServer()
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(lis) //nolint: errcheck
+	t.Cleanup(server.Stop)
+	return healthServer, server, int32(lis.Addr().(*net.TCPAddr).Port)
+}
+
+func newTestGRPCProber(port int32, service string, conns *grpcConnPool) *grpcProber {
+	return &grpcProber{service: service, port: port, timeout: time.Second, conns: conns}
+}
+
+func TestGRPCProbe(t *testing.T) {
+	healthServer, _, port := startHealthServer(t)
+	healthServer.SetServingStatus("serving", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("not-serving", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus("unknown", healthpb.HealthCheckResponse_UNKNOWN)
+
+	tests := []struct {
+		name    string
+		service string
+		want    results.Result
+	}{
+		{name: "server", service: "", want: results.Success},
+		{name: "serving service", service: "serving", want: results.Success},
+		{name: "not serving service", service: "not-serving", want: results.Failure},
+		{name: "unknown status", service: "unknown", want: results.Unknown},
+		// The health server answers NotFound for services it doesn't know.
+		{name: "unregistered service", service: "missing", want: results.Failure},
+	}
+	conns := newGRPCConnPool(time.Minute)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newTestGRPCProber(port, tt.service, conns).Probe(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Result != tt.want {
+				t.Errorf("expected %s, got %s (%s)", tt.want, r.Result, r.Detail)
+			}
+			if r.Result == results.Success && r.Latency <= 0 {
+				t.Errorf("expected the latency of a successful probe to be set")
+			}
+		})
+	}
+
+	// Answers of the server, NotFound included, keep the connection.
+	conns.lock.Lock()
+	defer conns.lock.Unlock()
+	if len(conns.conns) != 1 {
+		t.Errorf("expected all probes to share one connection, got %d", len(conns.conns))
+	}
+}
+
+func TestGRPCProbeReusesConnection(t *testing.T) {
+	_, server, port := startHealthServer(t)
+	conns := newGRPCConnPool(time.Minute)
+	p := newTestGRPCProber(port, "", conns)
+	target := net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))
+
+	for i := 0; i < 3; i++ {
+		if r, _ := p.Probe(context.Background(), "127.0.0.1"); r.Result != results.Success {
+			t.Fatalf("expected success, got %s (%s)", r.Result, r.Detail)
+		}
+	}
+	conns.lock.Lock()
+	conn, pooled := conns.conns[target]
+	count := len(conns.conns)
+	conns.lock.Unlock()
+	if !pooled || count != 1 {
+		t.Fatalf("expected one pooled connection to %s, got %d", target, count)
+	}
+	first := conn.conn
+
+	// An unreachable server discards the connection, the next probe dials again.
+	server.Stop()
+	if r, _ := p.Probe(context.Background(), "127.0.0.1"); r.Result != results.Failure {
+		t.Fatalf("expected failure once the server is stopped, got %s", r.Result)
+	}
+	conns.lock.Lock()
+	_, pooled = conns.conns[target]
+	conns.lock.Unlock()
+	if pooled {
+		t.Errorf("expected the connection to be discarded after a failed call")
+	}
+
+	_, _, port = startHealthServer(t)
+	p = newTestGRPCProber(port, "", conns)
+	if r, _ := p.Probe(context.Background(), "127.0.0.1"); r.Result != results.Success {
+		t.Fatalf("expected success, got %s (%s)", r.Result, r.Detail)
+	}
+	conns.lock.Lock()
+	defer conns.lock.Unlock()
+	for _, c := range conns.conns {
+		if c.conn == first {
+			t.Errorf("expected the discarded connection not to be reused")
+		}
+	}
+}
+
+func TestGRPCConnPoolClosesIdleConnections(t *testing.T) {
+	conns := newGRPCConnPool(time.Minute)
+	if _, err := conns.get("127.0.0.1:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	conns.lock.Lock()
+	conns.conns["127.0.0.1:1"].lastUsed = time.Now().Add(-2 * time.Minute)
+	conns.lastSweep = time.Now().Add(-2 * time.Minute)
+	conns.lock.Unlock()
+
+	if _, err := conns.get("127.0.0.1:2"); err != nil {
+		t.Fatal(err)
+	}
+	conns.lock.Lock()
+	defer conns.lock.Unlock()
+	if _, ok := conns.conns["127.0.0.1:1"]; ok {
+		t.Errorf("expected the idle connection to be closed")
+	}
+	if _, ok := conns.conns["127.0.0.1:2"]; !ok {
+		t.Errorf("expected the new connection to be pooled")
+	}
+	for _, c := range conns.conns {
+		c.conn.Close() //nolint: errcheck
+	}
+}
@@ -0,0 +1,241 @@
+package prober
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+const (
+	ServiceImportHTTPScheme         = "kosmos.io/probe-http-scheme"
+	ServiceImportHTTPPath           = "kosmos.io/probe-http-path"
+	ServiceImportHTTPPort           = "kosmos.io/probe-http-port"
+	ServiceImportHTTPHeaders        = "kosmos.io/probe-http-headers"
+	ServiceImportHTTPExpectedStatus = "kosmos.io/probe-http-expected-status"
+	ServiceImportHTTPExpectedBody   = "kosmos.io/probe-http-expected-body"
+)
+
+func init() {
+	MustRegister(HTTPProbe, newHTTPProber)
+}
+
+// maxHTTPBodyLength is the maximum number of bytes read from the response body for matching.
+const maxHTTPBodyLength = 10 * 1024
+
+// HTTPProbeConfig describes how the HTTP probe is performed.
+type HTTPProbeConfig struct {
+	// Scheme to use for connecting to the address, http or https.
+	Scheme string
+	// Path to access on the HTTP server.
+	Path string
+	// Port to access on the address. Zero means the first TCP port to probe.
+	Port int32
+	// Headers to set in the request.
+	Headers http.Header
+	// ExpectedStatus is the range of status codes considered successful.
+	ExpectedStatus StatusRange
+	// ExpectedBody, if not empty, must be contained in the response body.
+	ExpectedBody string
+}
+
+// StatusRange is an inclusive range of HTTP status codes.
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+func (r StatusRange) contains(code int) bool {
+	return code >= r.Min && code <= r.Max
+}
+
+func (r StatusRange) String() string {
+	if r.Min == r.Max {
+		return strconv.Itoa(r.Min)
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+// ParseStatusRange parses a status code range such as "200-399" or "200".
+func ParseStatusRange(s string) (StatusRange, error) {
+	lower, upper, found := strings.Cut(strings.TrimSpace(s), "-")
+	if !found {
+		upper = lower
+	}
+	low, err := strconv.Atoi(strings.TrimSpace(lower))
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("invalid status range %q", s)
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(upper))
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("invalid status range %q", s)
+	}
+	if low < 100 || high > 599 || low > high {
+		return StatusRange{}, fmt.Errorf("invalid status range %q", s)
+	}
+	return StatusRange{Min: low, Max: high}, nil
+}
+
+// ParseHTTPHeaders parses headers from a JSON object such as {"Host": "example.com"}.
+func ParseHTTPHeaders(s string) (http.Header, error) {
+	headers := http.Header{}
+	if strings.TrimSpace(s) == "" {
+		return headers, nil
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal([]byte(s), &values); err != nil {
+		return nil, fmt.Errorf("invalid http headers %q: %v", s, err)
+	}
+	for k, v := range values {
+		headers.Set(k, v)
+	}
+	return headers, nil
+}
+
+// Validate checks whether the HTTP probe configuration is usable.
+func (c *HTTPProbeConfig) Validate() error {
+	if c.Scheme != "http" && c.Scheme != "https" {
+		return fmt.Errorf("invalid http scheme %q", c.Scheme)
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("http path %q must start with /", c.Path)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid http port %d", c.Port)
+	}
+	return nil
+}
+
+// resolveHTTPProbeConfig overrides the defaults with the HTTP probe annotations of the ServiceImport.
+func resolveHTTPProbeConfig(defaults HTTPProbeConfig, svcImport *v1alpha1.ServiceImport) (*HTTPProbeConfig, error) {
+	c := defaults
+	c.Headers = defaults.Headers.Clone()
+
+	annotations := svcImport.Annotations
+	if v, ok := annotations[ServiceImportHTTPScheme]; ok {
+		c.Scheme = strings.ToLower(v)
+	}
+	if v, ok := annotations[ServiceImportHTTPPath]; ok {
+		c.Path = v
+	}
+	if v, ok := annotations[ServiceImportHTTPPort]; ok {
+		port, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http port %q", v)
+		}
+		c.Port = int32(port)
+	}
+	if v, ok := annotations[ServiceImportHTTPHeaders]; ok {
+		headers, err := ParseHTTPHeaders(v)
+		if err != nil {
+			return nil, err
+		}
+		c.Headers = headers
+	}
+	if v, ok := annotations[ServiceImportHTTPExpectedStatus]; ok {
+		statusRange, err := ParseStatusRange(v)
+		if err != nil {
+			return nil, err
+		}
+		c.ExpectedStatus = statusRange
+	}
+	if v, ok := annotations[ServiceImportHTTPExpectedBody]; ok {
+		c.ExpectedBody = v
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// httpProber issues a GET request against the address and judges the result by the status code
+// and, if configured, the response body.
+type httpProber struct {
+	config  *HTTPProbeConfig
+	port    int32
+	timeout time.Duration
+}
+
+func newHTTPProber(config *Config) (Prober, error) {
+	httpConfig, err := resolveHTTPProbeConfig(config.HTTP, config.ServiceImport)
+	if err != nil {
+		return nil, err
+	}
+
+	port := httpConfig.Port
+	if port == 0 {
+		if len(config.Ports) == 0 {
+			return nil, fmt.Errorf("no http port configured and no TCP ports found in serviceImport")
+		}
+		port = config.Ports[0]
+	}
+	return &httpProber{config: httpConfig, port: port, timeout: config.Timeout}, nil
+}
+
+func (p *httpProber) Probe(ctx context.Context, address string) (ProbeResult, error) {
+	u := &url.URL{
+		Scheme: p.config.Scheme,
+		Host:   net.JoinHostPort(address, strconv.Itoa(int(p.port))),
+		Path:   p.config.Path,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	for k, v := range p.config.Headers {
+		req.Header[k] = v
+	}
+	if host := p.config.Headers.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	client := &http.Client{
+		Timeout: p.timeout,
+		Transport: &http.Transport{
+			// Like the kubelet, certificates of the probed endpoints are not verified.
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint: gosec
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	start := time.Now()
+	if err := doHTTPProbe(client, p.config, req); err != nil {
+		return ProbeResult{Result: results.Failure, Detail: err.Error()}, nil
+	}
+	return ProbeResult{Result: results.Success, Latency: time.Since(start)}, nil
+}
+
+func doHTTPProbe(client *http.Client, config *HTTPProbeConfig, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBodyLength))
+	if err != nil {
+		return err
+	}
+	if !config.ExpectedStatus.contains(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d, expected %s", resp.StatusCode, config.ExpectedStatus)
+	}
+	if config.ExpectedBody != "" && !strings.Contains(string(body), config.ExpectedBody) {
+		return fmt.Errorf("response body does not contain %q", config.ExpectedBody)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+func defaultHTTPProbeConfig() HTTPProbeConfig {
+	return HTTPProbeConfig{
+		Scheme:         "http",
+		Path:           "/",
+		Headers:        http.Header{},
+		ExpectedStatus: StatusRange{Min: 200, Max: 399},
+	}
+}
+
+// startHTTPServer serves /status/<code>, /body and /header on a local port and returns the port.
+func startHTTPServer(t *testing.T) int32 {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(r.URL.Path[len("/status/"):])
+		if err != nil {
+			code = http.StatusBadRequest
+		}
+		w.WriteHeader(code)
+	})
+	mux.HandleFunc("/body", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "status: ok")
+	})
+	// /header answers 200 only if the probe sent the expected host and header.
+	mux.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "example.com" || r.Header.Get("X-Probe") != "eps" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return int32(server.Listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestHTTPProbe(t *testing.T) {
+	port := startHTTPServer(t)
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        results.Result
+	}{
+		{
+			name:        "status within the default range",
+			annotations: map[string]string{ServiceImportHTTPPath: "/status/204"},
+			want:        results.Success,
+		},
+		{
+			name:        "redirects are not followed",
+			annotations: map[string]string{ServiceImportHTTPPath: "/status/302"},
+			want:        results.Success,
+		},
+		{
+			name:        "status outside the default range",
+			annotations: map[string]string{ServiceImportHTTPPath: "/status/500"},
+			want:        results.Failure,
+		},
+		{
+			name: "expected status",
+			annotations: map[string]string{
+				ServiceImportHTTPPath:           "/status/503",
+				ServiceImportHTTPExpectedStatus: "500-503",
+			},
+			want: results.Success,
+		},
+		{
+			name: "unexpected status",
+			annotations: map[string]string{
+				ServiceImportHTTPPath:           "/status/200",
+				ServiceImportHTTPExpectedStatus: "201",
+			},
+			want: results.Failure,
+		},
+		{
+			name: "headers",
+			annotations: map[string]string{
+				ServiceImportHTTPPath:    "/header",
+				ServiceImportHTTPHeaders: `{"Host": "example.com", "X-Probe": "eps"}`,
+			},
+			want: results.Success,
+		},
+		{
+			name:        "missing headers",
+			annotations: map[string]string{ServiceImportHTTPPath: "/header"},
+			want:        results.Failure,
+		},
+		{
+			name: "body contains the expected body",
+			annotations: map[string]string{
+				ServiceImportHTTPPath:         "/body",
+				ServiceImportHTTPExpectedBody: "ok",
+			},
+			want: results.Success,
+		},
+		{
+			name: "body does not contain the expected body",
+			annotations: map[string]string{
+				ServiceImportHTTPPath:         "/body",
+				ServiceImportHTTPExpectedBody: "healthy",
+			},
+			want: results.Failure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svcImport := newTestServiceImport()
+			svcImport.Annotations = tt.annotations
+			p, err := newHTTPProber(&Config{
+				ServiceImport: svcImport,
+				Ports:         []int32{port},
+				Timeout:       time.Second,
+				HTTP:          defaultHTTPProbeConfig(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := p.Probe(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Result != tt.want {
+				t.Errorf("expected %s, got %s (%s)", tt.want, r.Result, r.Detail)
+			}
+		})
+	}
+}
+
+func TestHTTPProbeConnectionRefused(t *testing.T) {
+	p, err := newHTTPProber(&Config{
+		ServiceImport: newTestServiceImport(),
+		Ports:         []int32{closedTCPPort(t)},
+		Timeout:       time.Second,
+		HTTP:          defaultHTTPProbeConfig(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := p.Probe(context.Background(), "127.0.0.1"); r.Result != results.Failure {
+		t.Errorf("expected failure, got %s", r.Result)
+	}
+}
+
+func TestNewHTTPProberPort(t *testing.T) {
+	svcImport := newTestServiceImport()
+	p, err := newHTTPProber(&Config{ServiceImport: svcImport, Ports: []int32{8080, 9090}, HTTP: defaultHTTPProbeConfig()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := p.(*httpProber).port; port != 8080 {
+		t.Errorf("expected the first port 8080, got %d", port)
+	}
+
+	svcImport.Annotations = map[string]string{ServiceImportHTTPPort: "9443"}
+	p, err = newHTTPProber(&Config{ServiceImport: svcImport, Ports: []int32{8080}, HTTP: defaultHTTPProbeConfig()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := p.(*httpProber).port; port != 9443 {
+		t.Errorf("expected the configured port 9443, got %d", port)
+	}
+
+	if _, err := newHTTPProber(&Config{ServiceImport: newTestServiceImport(), HTTP: defaultHTTPProbeConfig()}); err == nil {
+		t.Errorf("expected an error without any port")
+	}
+}
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    StatusRange
+		wantErr bool
+	}{
+		{in: "200", want: StatusRange{Min: 200, Max: 200}},
+		{in: "200-399", want: StatusRange{Min: 200, Max: 399}},
+		{in: " 200 - 299 ", want: StatusRange{Min: 200, Max: 299}},
+		{in: "100-599", want: StatusRange{Min: 100, Max: 599}},
+		{in: "", wantErr: true},
+		{in: "ok", wantErr: true},
+		{in: "200-", wantErr: true},
+		{in: "-399", wantErr: true},
+		{in: "200-3xx", wantErr: true},
+		{in: "200-300-400", wantErr: true},
+		{in: "399-200", wantErr: true},
+		{in: "99", wantErr: true},
+		{in: "200-600", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseStatusRange(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseStatusRange(%q) returned error %v, want error %t", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseStatusRange(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHTTPHeaders(t *testing.T) {
+	headers, err := ParseHTTPHeaders(`{"host": "example.com", "X-Probe": "eps"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers.Get("Host") != "example.com" || headers.Get("X-Probe") != "eps" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+	if headers, err := ParseHTTPHeaders(" "); err != nil || len(headers) != 0 {
+		t.Errorf("expected no headers, got %v, %v", headers, err)
+	}
+	for _, in := range []string{"Host: example.com", `{"X-Probe": 1}`, `["Host"]`} {
+		if _, err := ParseHTTPHeaders(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+func init() {
+	MustRegister(ICMPProbe, newICMPProber)
+}
+
+const (
+	ServiceImportICMPCount          = "kosmos.io/probe-icmp-count"
+	ServiceImportICMPInterval       = "kosmos.io/probe-icmp-interval"
+	ServiceImportICMPMaxLossPercent = "kosmos.io/probe-icmp-max-loss-percent"
+	ServiceImportICMPMaxAvgRTT      = "kosmos.io/probe-icmp-max-avg-rtt"
+)
+
+// ICMPProbeConfig describes how many echo requests the ICMP probe sends and how the replies are judged.
+type ICMPProbeConfig struct {
+	// Count is the number of echo requests sent per probe.
+	Count int
+	// Interval between the echo requests.
+	Interval time.Duration
+	// MaxLossPercent is the highest percentage of lost packets a successful probe may have.
+	MaxLossPercent int
+	// MaxAvgRTT is the highest average round trip time a successful probe may have, zero means no limit.
+	MaxAvgRTT time.Duration
+}
+
+// Validate checks whether the ICMP probe configuration is usable.
+func (c *ICMPProbeConfig) Validate() error {
+	if c.Count < 1 {
+		return fmt.Errorf("icmp count must be at least 1")
+	}
+	if c.Interval <= 0 && c.Count > 1 {
+		return fmt.Errorf("icmp interval must be positive")
+	}
+	if c.MaxLossPercent < 0 || c.MaxLossPercent > 100 {
+		return fmt.Errorf("icmp max loss percent must be between 0 and 100")
+	}
+	if c.MaxAvgRTT < 0 {
+		return fmt.Errorf("icmp max avg rtt must not be negative")
+	}
+	return nil
+}
+
+// resolveICMPProbeConfig overrides the defaults with the ICMP probe annotations of the ServiceImport.
+func resolveICMPProbeConfig(defaults ICMPProbeConfig, svcImport *v1alpha1.ServiceImport) (*ICMPProbeConfig, error) {
+	c := defaults
+
+	annotations := svcImport.Annotations
+	if v, ok := annotations[ServiceImportICMPCount]; ok {
+		count, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid icmp count %q", v)
+		}
+		c.Count = count
+	}
+	if v, ok := annotations[ServiceImportICMPInterval]; ok {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid icmp interval %q", v)
+		}
+		c.Interval = interval
+	}
+	if v, ok := annotations[ServiceImportICMPMaxLossPercent]; ok {
+		loss, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid icmp max loss percent %q", v)
+		}
+		c.MaxLossPercent = loss
+	}
+	if v, ok := annotations[ServiceImportICMPMaxAvgRTT]; ok {
+		rtt, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid icmp max avg rtt %q", v)
+		}
+		c.MaxAvgRTT = rtt
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// icmpProber sends ICMP echo requests to the address and judges the address by packet loss and round trip time.
+type icmpProber struct {
+	config     *ICMPProbeConfig
+	timeout    time.Duration
+	privileged bool
+	// engine sends the echo over the shared sockets, a pinger with its own socket is used per probe if nil.
+	engine *icmpEngine
+}
+
+func newICMPProber(config *Config) (Prober, error) {
+	icmpConfig, err := resolveICMPProbeConfig(config.ICMP, config.ServiceImport)
+	if err != nil {
+		return nil, err
+	}
+	// All echo requests must be sent well within the probe timeout.
+	if time.Duration(icmpConfig.Count-1)*icmpConfig.Interval >= config.Timeout {
+		return nil, fmt.Errorf("sending %d icmp echo requests %s apart takes longer than the probe timeout %s",
+			icmpConfig.Count, icmpConfig.Interval, config.Timeout)
+	}
+
+	p := &icmpProber{
+		config:     icmpConfig,
+		timeout:    config.Timeout,
+		privileged: config.ICMPMode != ICMPModeUnprivileged,
+	}
+	if config.ICMPSharedSocket {
+		p.engine = sharedICMPEngine(p.privileged)
+	}
+	return p, nil
+}
+
+func (p *icmpProber) Probe(ctx context.Context, address string) (ProbeResult, error) {
+	var stats *PacketStats
+	var err error
+	if p.engine != nil {
+		stats, err = p.probeShared(ctx, address)
+	} else {
+		stats, err = p.probePinger(ctx, address)
+	}
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	return p.judge(stats), nil
+}
+
+// judge turns the packet statistics into a result.
+func (p *icmpProber) judge(stats *PacketStats) ProbeResult {
+	r := ProbeResult{Result: results.Success, Latency: stats.AvgRTT, Packets: stats}
+	switch {
+	case stats.Received == 0:
+		r.Result = results.Failure
+		r.Detail = fmt.Sprintf("no echo reply received within %s", p.timeout)
+	case stats.LossPercent > float64(p.config.MaxLossPercent):
+		r.Result = results.Failure
+		r.Detail = fmt.Sprintf("%d of %d echo replies received, packet loss %.0f%% exceeds %d%%",
+			stats.Received, stats.Sent, stats.LossPercent, p.config.MaxLossPercent)
+	case p.config.MaxAvgRTT > 0 && stats.AvgRTT > p.config.MaxAvgRTT:
+		r.Result = results.Failure
+		r.Detail = fmt.Sprintf("average round trip time %s exceeds %s", stats.AvgRTT, p.config.MaxAvgRTT)
+	}
+	return r
+}
+
+// probePinger sends the echo requests with a pinger using its own socket.
+func (p *icmpProber) probePinger(ctx context.Context, address string) (*PacketStats, error) {
+	pinger, err := ping.NewPinger(address)
+	if err != nil {
+		return nil, err
+	}
+
+	pinger.Count = p.config.Count
+	pinger.Interval = p.config.Interval
+	pinger.Timeout = p.timeout
+	pinger.SetPrivileged(p.privileged)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			pinger.Stop()
+		case <-done:
+		}
+	}()
+
+	if err := pinger.Run(); err != nil {
+		return nil, err
+	}
+
+	s := pinger.Statistics()
+	return &PacketStats{
+		// Echo requests which could not be sent in time are lost as well.
+		Sent:        p.config.Count,
+		Received:    s.PacketsRecv,
+		LossPercent: lossPercent(p.config.Count, s.PacketsRecv),
+		MinRTT:      s.MinRtt,
+		AvgRTT:      s.AvgRtt,
+		MaxRTT:      s.MaxRtt,
+	}, nil
+}
+
+// probeShared sends the echo requests with the shared ICMP engine.
+func (p *icmpProber) probeShared(ctx context.Context, address string) (*PacketStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var rtts []time.Duration
+	var firstErr error
+	for i := 0; i < p.config.Count; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(p.config.Interval):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, rtt, err := p.engine.ping(ctx, address)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			if ok {
+				rtts = append(rtts, rtt)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil && len(rtts) == 0 {
+		return nil, firstErr
+	}
+	return newPacketStats(p.config.Count, rtts), nil
+}
+
+// newPacketStats computes the statistics of the round trip times of the replies to sent echo requests.
+func newPacketStats(sent int, rtts []time.Duration) *PacketStats {
+	stats := &PacketStats{Sent: sent, Received: len(rtts), LossPercent: lossPercent(sent, len(rtts))}
+	var total time.Duration
+	for i, rtt := range rtts {
+		if i == 0 || rtt < stats.MinRTT {
+			stats.MinRTT = rtt
+		}
+		if rtt > stats.MaxRTT {
+			stats.MaxRTT = rtt
+		}
+		total += rtt
+	}
+	if len(rtts) > 0 {
+		stats.AvgRTT = total / time.Duration(len(rtts))
+	}
+	return stats
+}
+
+func lossPercent(sent, received int) float64 {
+	if sent == 0 {
+		return 0
+	}
+	return float64(sent-received) / float64(sent) * 100
+}
@@ -0,0 +1,255 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"k8s.io/klog/v2"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+
+	// icmpPayload is sent in every echo request.
+	icmpPayload = "eps-probe-plugin"
+)
+
+var (
+	icmpEnginesLock sync.Mutex
+	// icmpEngines are the process-wide engines, by privileged mode.
+	icmpEngines = map[bool]*icmpEngine{}
+)
+
+// sharedICMPEngine returns the process-wide engine of the ICMP mode.
+func sharedICMPEngine(privileged bool) *icmpEngine {
+	icmpEnginesLock.Lock()
+	defer icmpEnginesLock.Unlock()
+	e, ok := icmpEngines[privileged]
+	if !ok {
+		e = newICMPEngine(privileged)
+		icmpEngines[privileged] = e
+	}
+	return e
+}
+
+// icmpEngine sends the echo requests of all ICMP probes over one IPv4 and one IPv6 socket, which are
+// opened on first use and kept open. Replies are read asynchronously and matched to the pending requests
+// by identifier and sequence number.
+type icmpEngine struct {
+	privileged bool
+	// id is the identifier of the echo requests. Unprivileged sockets replace it with the port of the
+	// socket, the kernel only delivers the replies of the socket then.
+	id int
+
+	// guards conns, seq and pending
+	lock sync.Mutex
+	// open sockets by IP version
+	conns map[int]*icmp.PacketConn
+	// seq is the last used sequence number
+	seq uint16
+	// pending echo requests by IP version and sequence number
+	pending map[echoKey]*pendingEcho
+}
+
+type echoKey struct {
+	version int
+	seq     uint16
+}
+
+type pendingEcho struct {
+	ip net.IP
+	// received receives the time the reply arrived.
+	received chan time.Time
+}
+
+func newICMPEngine(privileged bool) *icmpEngine {
+	return &icmpEngine{
+		privileged: privileged,
+		id:         os.Getpid() & 0xffff,
+		conns:      map[int]*icmp.PacketConn{},
+		pending:    map[echoKey]*pendingEcho{},
+	}
+}
+
+// ping sends an echo request to the address and waits for the reply until ctx is done. It returns whether
+// a reply was received and its round trip time.
+func (e *icmpEngine) ping(ctx context.Context, address string) (bool, time.Duration, error) {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false, 0, fmt.Errorf("%q is not an IP address", address)
+	}
+	version := 4
+	if ip.To4() == nil {
+		version = 6
+	}
+
+	conn, key, echo, err := e.register(version, ip)
+	if err != nil {
+		return false, 0, err
+	}
+	defer e.unregister(key)
+
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{ID: e.id, Seq: int(key.seq), Data: []byte(icmpPayload)},
+	}
+	if version == 6 {
+		msg.Type = ipv6.ICMPTypeEchoRequest
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return false, 0, err
+	}
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if !e.privileged {
+		dst = &net.UDPAddr{IP: ip}
+	}
+	sent := time.Now()
+	if _, err := conn.WriteTo(data, dst); err != nil {
+		return false, 0, err
+	}
+
+	select {
+	case received := <-echo.received:
+		return true, received.Sub(sent), nil
+	case <-ctx.Done():
+		return false, 0, nil
+	}
+}
+
+// register allocates a free sequence number for an echo request to the ip, opening the socket of the IP
+// version if needed.
+func (e *icmpEngine) register(version int, ip net.IP) (*icmp.PacketConn, echoKey, *pendingEcho, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	conn, ok := e.conns[version]
+	if !ok {
+		var err error
+		conn, err = e.listen(version)
+		if err != nil {
+			return nil, echoKey{}, nil, err
+		}
+		e.conns[version] = conn
+		go e.receive(version, conn)
+	}
+
+	for i := 0; i <= 0xffff; i++ {
+		e.seq++
+		key := echoKey{version: version, seq: e.seq}
+		if _, inUse := e.pending[key]; inUse {
+			continue
+		}
+		echo := &pendingEcho{ip: ip, received: make(chan time.Time, 1)}
+		e.pending[key] = echo
+		metrics.ICMPPendingEchos.Inc()
+		return conn, key, echo, nil
+	}
+	return nil, echoKey{}, nil, fmt.Errorf("too many pending ICMPv%d echo requests", version)
+}
+
+func (e *icmpEngine) unregister(key echoKey) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if _, ok := e.pending[key]; ok {
+		delete(e.pending, key)
+		metrics.ICMPPendingEchos.Dec()
+	}
+}
+
+func (e *icmpEngine) listen(version int) (*icmp.PacketConn, error) {
+	network, address := e.network(version)
+	conn, err := icmp.ListenPacket(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s socket: %v", network, err)
+	}
+	klog.InfoS("Opened shared ICMP socket", "network", network)
+	return conn, nil
+}
+
+// network returns the network and address of the socket of the IP version, raw sockets are used in
+// privileged mode and datagram sockets otherwise.
+func (e *icmpEngine) network(version int) (string, string) {
+	switch {
+	case version == 4 && e.privileged:
+		return "ip4:icmp", "0.0.0.0"
+	case version == 4:
+		return "udp4", "0.0.0.0"
+	case e.privileged:
+		return "ip6:ipv6-icmp", "::"
+	default:
+		return "udp6", "::"
+	}
+}
+
+// receive reads the replies of the socket and hands them to the pending echo requests. The socket is
+// closed on read errors, it is opened again by the next echo request.
+func (e *icmpEngine) receive(version int, conn *icmp.PacketConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			klog.ErrorS(err, "Could not read from shared ICMP socket, closing it", "version", version)
+			e.lock.Lock()
+			if e.conns[version] == conn {
+				delete(e.conns, version)
+			}
+			e.lock.Unlock()
+			conn.Close() //nolint: errcheck
+			return
+		}
+		e.handleReply(version, buf[:n], peer, time.Now())
+	}
+}
+
+// handleReply hands the message received from the peer to the pending echo request it replies to, other
+// messages are dropped.
+func (e *icmpEngine) handleReply(version int, data []byte, peer net.Addr, received time.Time) {
+	proto := protocolICMP
+	if version == 6 {
+		proto = protocolIPv6ICMP
+	}
+	msg, err := icmp.ParseMessage(proto, data)
+	if err != nil {
+		klog.V(5).InfoS("Dropping unparsable ICMP message", "peer", peer, "err", err)
+		return
+	}
+	if msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply {
+		return
+	}
+	reply, ok := msg.Body.(*icmp.Echo)
+	if !ok || (e.privileged && reply.ID != e.id) {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	echo, ok := e.pending[echoKey{version: version, seq: uint16(reply.Seq)}]
+	if ok && echo.ip.Equal(peerIP(peer)) {
+		select {
+		case echo.received <- received:
+		default: // Duplicate reply.
+		}
+	}
+}
+
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package prober
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// echoReply returns an echo reply of the IP version with the identifier and sequence number.
+func echoReply(t *testing.T, version, id, seq int) []byte {
+	t.Helper()
+	msg := icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte(icmpPayload)}}
+	if version == 6 {
+		msg.Type = ipv6.ICMPTypeEchoReply
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestICMPEngineHandleReply(t *testing.T) {
+	v4Peer := &net.IPAddr{IP: net.ParseIP("10.0.0.1")}
+	v6Peer := &net.UDPAddr{IP: net.ParseIP("fd00::1")}
+	echoRequest, err := (&icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: 1, Seq: 1}}).Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		privileged bool
+		version    int
+		data       []byte
+		peer       net.Addr
+		want       bool
+	}{
+		{
+			name:       "matching IPv4 reply",
+			privileged: true,
+			version:    4,
+			data:       echoReply(t, 4, 1, 1),
+			peer:       v4Peer,
+			want:       true,
+		},
+		{
+			name:       "matching IPv6 reply",
+			privileged: true,
+			version:    6,
+			data:       echoReply(t, 6, 1, 1),
+			peer:       &net.IPAddr{IP: v6Peer.IP},
+			want:       true,
+		},
+		{
+			name:       "other identifier",
+			privileged: true,
+			version:    4,
+			data:       echoReply(t, 4, 2, 1),
+			peer:       v4Peer,
+		},
+		{
+			// Unprivileged sockets replace the identifier with the port of the socket.
+			name:    "other identifier of unprivileged socket",
+			version: 6,
+			data:    echoReply(t, 6, 2, 1),
+			peer:    v6Peer,
+			want:    true,
+		},
+		{
+			name:       "other sequence number",
+			privileged: true,
+			version:    4,
+			data:       echoReply(t, 4, 1, 2),
+			peer:       v4Peer,
+		},
+		{
+			name:       "other peer",
+			privileged: true,
+			version:    4,
+			data:       echoReply(t, 4, 1, 1),
+			peer:       &net.IPAddr{IP: net.ParseIP("10.0.0.2")},
+		},
+		{
+			name:       "peer of the other IP version",
+			privileged: true,
+			version:    6,
+			data:       echoReply(t, 6, 1, 1),
+			peer:       v4Peer,
+		},
+		{
+			name:       "echo request",
+			privileged: true,
+			version:    4,
+			data:       echoRequest,
+			peer:       v4Peer,
+		},
+		{
+			name:       "unparsable message",
+			privileged: true,
+			version:    4,
+			data:       []byte{0},
+			peer:       v4Peer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newICMPEngine(tt.privileged)
+			e.id = 1
+			v4Echo := &pendingEcho{ip: v4Peer.IP, received: make(chan time.Time, 1)}
+			v6Echo := &pendingEcho{ip: v6Peer.IP, received: make(chan time.Time, 1)}
+			e.pending[echoKey{version: 4, seq: 1}] = v4Echo
+			e.pending[echoKey{version: 6, seq: 1}] = v6Echo
+			echo := v4Echo
+			if tt.version == 6 {
+				echo = v6Echo
+			}
+
+			received := time.Now()
+			e.handleReply(tt.version, tt.data, tt.peer, received)
+			// A duplicate reply must not block.
+			e.handleReply(tt.version, tt.data, tt.peer, received)
+
+			select {
+			case got := <-echo.received:
+				if !tt.want {
+					t.Errorf("expected the message to be dropped")
+				} else if !got.Equal(received) {
+					t.Errorf("expected the reply to be received at %v, got %v", received, got)
+				}
+			default:
+				if tt.want {
+					t.Errorf("expected the reply to be handed to the pending echo request")
+				}
+			}
+		})
+	}
+}
+
+func TestICMPEngineNetwork(t *testing.T) {
+	tests := []struct {
+		privileged  bool
+		version     int
+		wantNetwork string
+		wantAddress string
+	}{
+		{privileged: true, version: 4, wantNetwork: "ip4:icmp", wantAddress: "0.0.0.0"},
+		{privileged: true, version: 6, wantNetwork: "ip6:ipv6-icmp", wantAddress: "::"},
+		{privileged: false, version: 4, wantNetwork: "udp4", wantAddress: "0.0.0.0"},
+		{privileged: false, version: 6, wantNetwork: "udp6", wantAddress: "::"},
+	}
+	for _, tt := range tests {
+		network, address := newICMPEngine(tt.privileged).network(tt.version)
+		if network != tt.wantNetwork || address != tt.wantAddress {
+			t.Errorf("expected the %s %s socket for IPv%d with privileged %t, got %s %s",
+				tt.wantNetwork, tt.wantAddress, tt.version, tt.privileged, network, address)
+		}
+	}
+}
+
+func TestICMPEnginePingRejectsNonIPAddress(t *testing.T) {
+	e := newICMPEngine(false)
+	for _, address := range []string{"localhost", "example.com", "10.0.0.1:80", ""} {
+		if _, _, err := e.ping(context.TODO(), address); err == nil {
+			t.Errorf("expected %q to be rejected", address)
+		}
+	}
+	if len(e.conns) != 0 {
+		t.Errorf("expected no socket to be opened, got %d", len(e.conns))
+	}
+}
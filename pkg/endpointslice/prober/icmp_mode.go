@@ -0,0 +1,147 @@
+package prober
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
+)
+
+// ICMPMode is the kind of socket the ICMP probe uses.
+type ICMPMode string
+
+const (
+	// ICMPModeAuto selects unprivileged mode if the kernel allows it and privileged mode otherwise.
+	ICMPModeAuto ICMPMode = "auto"
+
+	// ICMPModePrivileged uses raw sockets, which requires CAP_NET_RAW.
+	ICMPModePrivileged ICMPMode = "privileged"
+
+	// ICMPModeUnprivileged uses datagram sockets, which requires the group of the process to be
+	// within net.ipv4.ping_group_range.
+	ICMPModeUnprivileged ICMPMode = "unprivileged"
+)
+
+// The files the ICMP mode is detected from, variables to be replaced in tests.
+var (
+	pingGroupRangeFile = "/proc/sys/net/ipv4/ping_group_range"
+	procStatusFile     = "/proc/self/status"
+)
+
+// capNetRaw is the bit of CAP_NET_RAW in the capability sets.
+const capNetRaw = 13
+
+// ResolveICMPMode turns the requested ICMP mode into the mode actually used, detecting what the
+// process is allowed to do. The active mode is logged and exposed as a metric.
+func ResolveICMPMode(requested ICMPMode) (ICMPMode, error) {
+	unprivileged, err := unprivilegedICMPAllowed()
+	if err != nil {
+		klog.V(3).InfoS("Could not detect unprivileged ICMP support", "err", err)
+	}
+	privileged, err := hasCapNetRaw()
+	if err != nil {
+		klog.V(3).InfoS("Could not detect CAP_NET_RAW", "err", err)
+	}
+
+	var mode ICMPMode
+	switch requested {
+	case ICMPModeAuto:
+		switch {
+		case unprivileged:
+			mode = ICMPModeUnprivileged
+		case privileged:
+			mode = ICMPModePrivileged
+		default:
+			mode = ICMPModePrivileged
+			klog.InfoS("Neither net.ipv4.ping_group_range allows the process group nor CAP_NET_RAW is granted, " +
+				"falling back to privileged ICMP mode, ICMP probes are likely to fail")
+		}
+	case ICMPModePrivileged:
+		mode = requested
+		if !privileged {
+			klog.InfoS("Privileged ICMP mode requested but CAP_NET_RAW is not granted, ICMP probes are likely to fail")
+		}
+	case ICMPModeUnprivileged:
+		mode = requested
+		if !unprivileged {
+			klog.InfoS("Unprivileged ICMP mode requested but net.ipv4.ping_group_range does not allow the process group, " +
+				"ICMP probes are likely to fail")
+		}
+	default:
+		return "", fmt.Errorf("unknown icmp mode %q", requested)
+	}
+
+	klog.InfoS("Using ICMP mode", "mode", mode, "requested", requested,
+		"unprivilegedAllowed", unprivileged, "capNetRaw", privileged)
+	for _, m := range []ICMPMode{ICMPModePrivileged, ICMPModeUnprivileged} {
+		value := 0.0
+		if m == mode {
+			value = 1
+		}
+		metrics.ICMPMode.WithLabelValues(string(m)).Set(value)
+	}
+	return mode, nil
+}
+
+// unprivilegedICMPAllowed checks whether any group of the process is within net.ipv4.ping_group_range.
+func unprivilegedICMPAllowed() (bool, error) {
+	data, err := os.ReadFile(pingGroupRangeFile)
+	if err != nil {
+		return false, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return false, fmt.Errorf("unexpected content of %s: %q", pingGroupRangeFile, string(data))
+	}
+	low, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return false, err
+	}
+	high, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	groups, err := os.Getgroups()
+	if err != nil {
+		return false, err
+	}
+	groups = append(groups, os.Getgid())
+	for _, gid := range groups {
+		if int64(gid) >= low && int64(gid) <= high {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hasCapNetRaw checks whether CAP_NET_RAW is in the effective capability set of the process.
+func hasCapNetRaw() (bool, error) {
+	f, err := os.Open(procStatusFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			return false, err
+		}
+		return caps&(1<<capNetRaw) != 0, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, fmt.Errorf("CapEff not found in %s", procStatusFile)
+}
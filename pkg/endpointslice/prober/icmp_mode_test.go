@@ -0,0 +1,86 @@
+package prober
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeICMPPermissions points the ICMP mode detection to files granting the given permissions.
+func fakeICMPPermissions(t *testing.T, unprivileged, capNetRaw bool) {
+	t.Helper()
+	dir := t.TempDir()
+
+	// The kernel default "1 0" allows no group at all.
+	pingGroupRange := "1\t0\n"
+	if unprivileged {
+		pingGroupRange = "0\t2147483647\n"
+	}
+	capEff := "0000000000000000"
+	if capNetRaw {
+		capEff = "0000000000002000"
+	}
+	files := map[string]string{
+		"ping_group_range": pingGroupRange,
+		"status":           "Name:\teps-probe-plugin\nCapPrm:\t" + capEff + "\nCapEff:\t" + capEff + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldPingGroupRangeFile, oldProcStatusFile := pingGroupRangeFile, procStatusFile
+	pingGroupRangeFile, procStatusFile = filepath.Join(dir, "ping_group_range"), filepath.Join(dir, "status")
+	t.Cleanup(func() {
+		pingGroupRangeFile, procStatusFile = oldPingGroupRangeFile, oldProcStatusFile
+	})
+}
+
+func TestResolveICMPMode(t *testing.T) {
+	tests := []struct {
+		name         string
+		requested    ICMPMode
+		unprivileged bool
+		capNetRaw    bool
+		want         ICMPMode
+	}{
+		{name: "forced privileged", requested: ICMPModePrivileged, capNetRaw: true, want: ICMPModePrivileged},
+		{name: "forced privileged without CAP_NET_RAW", requested: ICMPModePrivileged, unprivileged: true, want: ICMPModePrivileged},
+		{name: "forced unprivileged", requested: ICMPModeUnprivileged, unprivileged: true, want: ICMPModeUnprivileged},
+		{name: "forced unprivileged without ping group", requested: ICMPModeUnprivileged, capNetRaw: true, want: ICMPModeUnprivileged},
+		{name: "auto prefers unprivileged", requested: ICMPModeAuto, unprivileged: true, capNetRaw: true, want: ICMPModeUnprivileged},
+		{name: "auto with CAP_NET_RAW only", requested: ICMPModeAuto, capNetRaw: true, want: ICMPModePrivileged},
+		{name: "auto without any permission", requested: ICMPModeAuto, want: ICMPModePrivileged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeICMPPermissions(t, tt.unprivileged, tt.capNetRaw)
+			got, err := ResolveICMPMode(tt.requested)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected mode %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveICMPModeWithoutProcFiles(t *testing.T) {
+	oldPingGroupRangeFile, oldProcStatusFile := pingGroupRangeFile, procStatusFile
+	pingGroupRangeFile, procStatusFile = filepath.Join(t.TempDir(), "missing"), filepath.Join(t.TempDir(), "missing")
+	defer func() {
+		pingGroupRangeFile, procStatusFile = oldPingGroupRangeFile, oldProcStatusFile
+	}()
+
+	if got, err := ResolveICMPMode(ICMPModeAuto); err != nil || got != ICMPModePrivileged {
+		t.Errorf("expected privileged mode, got %s, %v", got, err)
+	}
+}
+
+func TestResolveICMPModeUnknown(t *testing.T) {
+	if _, err := ResolveICMPMode("raw"); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+}
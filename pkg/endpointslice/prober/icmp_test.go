@@ -0,0 +1,124 @@
+package prober
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+func TestNewPacketStats(t *testing.T) {
+	tests := []struct {
+		name string
+		sent int
+		rtts []time.Duration
+		want PacketStats
+	}{
+		{
+			name: "all received",
+			sent: 3,
+			rtts: []time.Duration{2 * time.Millisecond, time.Millisecond, 6 * time.Millisecond},
+			want: PacketStats{Sent: 3, Received: 3, MinRTT: time.Millisecond, AvgRTT: 3 * time.Millisecond,
+				MaxRTT: 6 * time.Millisecond},
+		},
+		{
+			name: "partial loss",
+			sent: 4,
+			rtts: []time.Duration{4 * time.Millisecond},
+			want: PacketStats{Sent: 4, Received: 1, LossPercent: 75, MinRTT: 4 * time.Millisecond,
+				AvgRTT: 4 * time.Millisecond, MaxRTT: 4 * time.Millisecond},
+		},
+		{
+			name: "none received",
+			sent: 2,
+			want: PacketStats{Sent: 2, LossPercent: 100},
+		},
+		{
+			name: "none sent",
+			want: PacketStats{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newPacketStats(tt.sent, tt.rtts); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, *got)
+			}
+		})
+	}
+}
+
+func TestICMPProberJudge(t *testing.T) {
+	// The defaults of the icmp flags.
+	defaults := ICMPProbeConfig{Count: 1, Interval: 100 * time.Millisecond, MaxLossPercent: 50}
+	budget := ICMPProbeConfig{Count: 4, Interval: 100 * time.Millisecond, MaxLossPercent: 25,
+		MaxAvgRTT: 10 * time.Millisecond}
+
+	tests := []struct {
+		name   string
+		config ICMPProbeConfig
+		stats  PacketStats
+		want   results.Result
+	}{
+		{
+			name:   "default budget reply",
+			config: defaults,
+			stats:  PacketStats{Sent: 1, Received: 1, AvgRTT: time.Second},
+			want:   results.Success,
+		},
+		{
+			name:   "default budget no reply",
+			config: defaults,
+			stats:  PacketStats{Sent: 1, LossPercent: 100},
+			want:   results.Failure,
+		},
+		{
+			// Zero packets received fails even if the loss budget allows any loss.
+			name:   "no reply within any loss budget",
+			config: ICMPProbeConfig{Count: 1, MaxLossPercent: 100},
+			stats:  PacketStats{Sent: 1, LossPercent: 100},
+			want:   results.Failure,
+		},
+		{
+			name:   "loss at the threshold",
+			config: budget,
+			stats:  PacketStats{Sent: 4, Received: 3, LossPercent: 25, AvgRTT: time.Millisecond},
+			want:   results.Success,
+		},
+		{
+			name:   "loss above the threshold",
+			config: budget,
+			stats:  PacketStats{Sent: 4, Received: 2, LossPercent: 50, AvgRTT: time.Millisecond},
+			want:   results.Failure,
+		},
+		{
+			name:   "rtt at the threshold",
+			config: budget,
+			stats:  PacketStats{Sent: 4, Received: 4, AvgRTT: 10 * time.Millisecond},
+			want:   results.Success,
+		},
+		{
+			name:   "rtt above the threshold",
+			config: budget,
+			stats:  PacketStats{Sent: 4, Received: 4, AvgRTT: 11 * time.Millisecond},
+			want:   results.Failure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			p := &icmpProber{config: &config, timeout: time.Second}
+			stats := tt.stats
+			r := p.judge(&stats)
+			if r.Result != tt.want {
+				t.Errorf("expected %s, got %s (%s)", tt.want, r.Result, r.Detail)
+			}
+			if r.Result == results.Failure && r.Detail == "" {
+				t.Errorf("expected the failure to be detailed")
+			}
+			if r.Latency != stats.AvgRTT || r.Packets != &stats {
+				t.Errorf("expected the average round trip time and the packet statistics to be reported, got %+v", r)
+			}
+		})
+	}
+}
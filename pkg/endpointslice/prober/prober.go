@@ -1,39 +1,114 @@
 package prober
 
 import (
+	"context"
 	"time"
 
-	"github.com/go-ping/ping"
-	"k8s.io/klog/v2"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
 	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
 )
 
-func runProber(addresses []string) (map[string]results.Result, error) {
-	result := map[string]results.Result{}
-	for _, address := range addresses {
-		pinger, err := ping.NewPinger(address)
-		if err != nil {
-			return nil, err
-		}
-
-		pinger.Count = 1
-		pinger.Timeout = time.Second
-		pinger.SetPrivileged(true)
-
-		if err := pinger.Run(); err != nil {
-			klog.ErrorS(err, "Run pinger failed.", "address", address)
-			return nil, err
-		}
-
-		stats := pinger.Statistics()
-		if stats.PacketsRecv >= 1 {
-			result[address] = results.Success
-			klog.V(5).InfoS("Ping success", "address", address)
-		} else {
-			result[address] = results.Failure
-			klog.V(3).InfoS("Ping failed", "address", address)
-		}
-	}
-	return result, nil
+// ProbeType is the name a Prober is registered and selected with.
+type ProbeType string
+
+const (
+	// ICMPProbe sends a single ICMP echo to every address.
+	ICMPProbe ProbeType = "icmp"
+
+	// TCPProbe dials every port of the ServiceImport on every address.
+	TCPProbe ProbeType = "tcp"
+
+	// HTTPProbe issues an HTTP(S) GET against every address.
+	HTTPProbe ProbeType = "http"
+
+	// GRPCProbe calls the gRPC Health Checking Protocol on every address.
+	GRPCProbe ProbeType = "grpc"
+)
+
+const (
+	// ServiceImportProbeType selects the probe type of a ServiceImport, overriding the global default.
+	ServiceImportProbeType = "kosmos.io/probe-type"
+)
+
+// Reasons of the events recorded on ServiceImports and ProbePolicies.
+const (
+	// EndpointUnreachable is recorded when an address reaches the failure threshold.
+	EndpointUnreachable = "EndpointUnreachable"
+
+	// EndpointRecovered is recorded when an unreachable address reaches the success threshold.
+	EndpointRecovered = "EndpointRecovered"
+
+	// EndpointDegraded is recorded when a reachable address reaches the degraded threshold.
+	EndpointDegraded = "EndpointDegraded"
+
+	// EndpointWithinBudget is recorded when a degraded address reaches the degraded recovery threshold.
+	EndpointWithinBudget = "EndpointWithinBudget"
+
+	// InvalidAddress is recorded when entries of the probed addresses can't be parsed and are skipped.
+	InvalidAddress = "InvalidAddress"
+
+	// InvalidProbe is recorded when the probe configuration of a ServiceImport is invalid.
+	InvalidProbe = "InvalidProbe"
+
+	// InvalidProbePolicy is recorded on a ProbePolicy which can't be applied to the ServiceImports it selects.
+	InvalidProbePolicy = "InvalidProbePolicy"
+)
+
+// Prober checks the connectivity of a single address.
+type Prober interface {
+	// Probe probes the address once. The returned error means the probe could not be performed at all,
+	// an unreachable address is reported through ProbeResult instead.
+	Probe(ctx context.Context, address string) (ProbeResult, error)
+}
+
+// ProbeResult is the outcome of probing a single address.
+type ProbeResult struct {
+	Result results.Result
+
+	// Latency is the time taken by the probe, e.g. the round-trip time of an ICMP echo.
+	Latency time.Duration
+
+	// Detail describes the result in a human-readable way, e.g. the reason of a failure.
+	Detail string
+
+	// Packets are the packet statistics of probes sending several packets, nil for other probes.
+	Packets *PacketStats
+}
+
+// PacketStats are the statistics of the packets sent by a probe.
+type PacketStats struct {
+	Sent     int
+	Received int
+	// LossPercent is the percentage of sent packets without reply.
+	LossPercent float64
+	MinRTT      time.Duration
+	AvgRTT      time.Duration
+	MaxRTT      time.Duration
+}
+
+// Config is what a Factory needs to build a Prober for a ServiceImport.
+type Config struct {
+	// ServiceImport to build the Prober for. Factories may read their own annotations from it.
+	ServiceImport *v1alpha1.ServiceImport
+
+	// Ports are the TCP ports to probe, either from the ProbePolicy or the ServiceImport.
+	Ports []int32
+
+	// Timeout of a single probe.
+	Timeout time.Duration
+
+	// ICMPMode is the resolved ICMP mode, either privileged or unprivileged.
+	ICMPMode ICMPMode
+	// ICMPSharedSocket sends all echo requests over one shared socket per IP version.
+	ICMPSharedSocket bool
+
+	// ICMP holds the global defaults of the icmp probe.
+	ICMP ICMPProbeConfig
+
+	// HTTP holds the global defaults of the http probe.
+	HTTP HTTPProbeConfig
+
+	// GRPC holds the global defaults of the grpc probe.
+	GRPC GRPCProbeConfig
 }
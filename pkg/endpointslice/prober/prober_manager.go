@@ -2,17 +2,21 @@ package prober
 
 import (
 	"fmt"
-	"reflect"
 	"sort"
 	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	eventrecord "k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
-	"k8s.io/utils/clock"
 	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
 	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
 	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/annotation"
 	"github.com/kosmos.io/eps-probe-plugin/pkg/util"
 )
@@ -23,14 +27,18 @@ const (
 
 type Manager interface {
 	// AddServiceImport creates new probe workers for every ServiceImport probe. This should be called for every
-	// ServiceImport created.
-	AddServiceImport(svcImport *v1alpha1.ServiceImport)
+	// ServiceImport created. The policy is the ProbePolicy selecting the ServiceImport, nil if there is none,
+	// and the targets are the probed addresses. If the probe configuration of the ServiceImport is invalid,
+	// the addresses are probed with the global probe configuration and the error is returned.
+	AddServiceImport(svcImport *v1alpha1.ServiceImport, policy *kosmosv1alpha1.ProbePolicy, targets *Targets) error
 
 	// GetServiceImport checks if the probe workers has been created.
 	GetServiceImport(namespaceName string) bool
 
-	// UpdateServiceImport sends UpdateChan to worker.
-	UpdateServiceImport(svcImport *v1alpha1.ServiceImport) error
+	// UpdateServiceImport updates the addresses and the probe configuration of the probe workers. If the probe
+	// configuration is invalid, the addresses are updated and probed with the current probe configuration,
+	// and an event is recorded once.
+	UpdateServiceImport(svcImport *v1alpha1.ServiceImport, policy *kosmosv1alpha1.ProbePolicy, targets *Targets) error
 
 	// RemoveServiceImport handles cleaning up the removed ServiceImport.
 	RemoveServiceImport(namespaceName string)
@@ -40,16 +48,21 @@ type Manager interface {
 }
 
 // NewManager creates a Manager for serviceImport and endpointSlice probing.
-func NewManager(resultsManager results.Manager, periodSeconds, failureThreshold int) Manager {
-	return &manager{
+// The spec is used as the default probe configuration of every serviceImport, and concurrency bounds the
+// number of probes running at the same time. Reachability transitions are recorded as events by the recorder.
+// Probes are run by a scheduler on a pool of concurrency goroutines, an address probed the same way for
+// several serviceImports is probed once.
+func NewManager(resultsManager results.Manager, spec ProbeSpec, concurrency int, recorder eventrecord.EventRecorder) Manager {
+	m := &manager{
+		recorder:       recorder,
 		workers:        make(map[probeKey]*worker),
-		start:          clock.RealClock{}.Now(),
+		targets:        make(map[string][]*target),
+		scheduler:      newScheduler(concurrency),
 		resultsManager: resultsManager,
-		spec: probeSpec{
-			PeriodSeconds:    periodSeconds,
-			FailureThreshold: failureThreshold,
-		},
+		spec:           spec,
 	}
+	go m.scheduler.run(wait.NeverStop)
+	return m
 }
 
 type manager struct {
@@ -62,21 +75,44 @@ type manager struct {
 	// resultsManager manages the results of probes
 	resultsManager results.Manager
 
-	spec probeSpec
+	// recorder records the reachability transitions of addresses on the serviceImports
+	recorder eventrecord.EventRecorder
 
-	start time.Time
+	// Map of active probe targets by address, shared by the workers probing an address the same way
+	targets map[string][]*target
+
+	// Lock for accessing & mutating targets
+	targetLock sync.Mutex
+
+	// scheduler runs the probes of the targets
+	scheduler *scheduler
+
+	spec ProbeSpec
 }
 
-type probeSpec struct {
+// ProbeSpec is the global probe configuration.
+type ProbeSpec struct {
 	PeriodSeconds    int
+	Timeout          time.Duration
 	FailureThreshold int
+	SuccessThreshold int
+	Type             ProbeType
+	ICMPMode         ICMPMode
+	ICMPSharedSocket bool
+	ICMP             ICMPProbeConfig
+	HTTP             HTTPProbeConfig
+	GRPC             GRPCProbeConfig
+	Degraded         DegradedBudget
+	// StatusReportPeriod is how often the address statuses are published while no address changes its
+	// result, zero publishes them on changes only.
+	StatusReportPeriod time.Duration
 }
 
 type probeKey struct {
 	namespacedName string
 }
 
-func (m *manager) AddServiceImport(svcImport *v1alpha1.ServiceImport) {
+func (m *manager) AddServiceImport(svcImport *v1alpha1.ServiceImport, policy *kosmosv1alpha1.ProbePolicy, targets *Targets) error {
 	m.workerLock.Lock()
 	defer m.workerLock.Unlock()
 
@@ -84,24 +120,40 @@ func (m *manager) AddServiceImport(svcImport *v1alpha1.ServiceImport) {
 	key := probeKey{namespacedName: namespaceName}
 	if _, ok := m.workers[key]; ok {
 		klog.ErrorS(nil, "Probe already exists for serviceImport", "serviceImport", klog.KObj(svcImport))
-		return
+		return nil
 	}
 
-	addrs, err := util.ConvertStringToAddresses(svcImport.Annotations[ServiceImportEPSAddr])
-	if err != nil {
-		klog.ErrorS(err, "Can't parse ips from annotations", "serviceImport", klog.KObj(svcImport))
-		return
+	// Invalid entries of the published addresses are dropped, they are published again without them.
+	unreachableAddrs, errs := util.ConvertStringToAddresses(svcImport.Annotations[annotation.ServiceImportNotReachableEPSAddr])
+	if len(errs) > 0 {
+		klog.ErrorS(utilerrors.NewAggregate(errs), "Skipping invalid published unreachable addresses", "serviceImport", klog.KObj(svcImport))
+	}
+	degradedAddrs, errs := util.ConvertStringToAddresses(svcImport.Annotations[annotation.ServiceImportDegradedEPSAddr])
+	if len(errs) > 0 {
+		klog.ErrorS(utilerrors.NewAggregate(errs), "Skipping invalid published degraded addresses", "serviceImport", klog.KObj(svcImport))
 	}
 
-	unreachableAddrs, err := util.ConvertStringToAddresses(svcImport.Annotations[annotation.ServiceImportNotReachableEPSAddr])
+	// Rather than not probing at all, an invalid probe configuration falls back to the global one.
+	spec, prober, err := m.resolveProber(svcImport, policy, targets)
 	if err != nil {
-		klog.ErrorS(err, "Can't parse ips from annotations", "serviceImport", klog.KObj(svcImport))
-		return
+		m.recorder.Eventf(svcImport, corev1.EventTypeWarning, InvalidProbe,
+			"Probing with the global probe configuration, the probe configuration is invalid: %v", err)
+		spec = m.defaultProbe()
+		var fallbackErr error
+		if prober, fallbackErr = m.buildProber(svcImport, spec, targets); fallbackErr != nil {
+			klog.ErrorS(fallbackErr, "Can't build prober from the global probe configuration", "serviceImport", klog.KObj(svcImport))
+			return utilerrors.NewAggregate([]error{err, fallbackErr})
+		}
 	}
 
-	w := newWorker(m, addrs, unreachableAddrs, svcImport)
+	w := newWorker(m, targets.Addresses, unreachableAddrs, degradedAddrs, svcImport, spec, prober)
+	if err != nil {
+		w.invalidProbe = err.Error()
+	}
 	m.workers[key] = w
-	go w.run()
+	metrics.ProbeWorkers.Inc()
+	w.start()
+	return err
 }
 
 func (m *manager) GetServiceImport(namespaceName string) bool {
@@ -109,49 +161,88 @@ func (m *manager) GetServiceImport(namespaceName string) bool {
 	return ok
 }
 
-func (m *manager) UpdateServiceImport(svcImport *v1alpha1.ServiceImport) error {
-	desired, err := util.ConvertStringToAddresses(svcImport.Annotations[ServiceImportEPSAddr])
-	if err != nil {
-		klog.ErrorS(err, "Can't parse ips from annotations", "serviceImport", klog.KObj(svcImport))
-		return err
-	}
+func (m *manager) UpdateServiceImport(svcImport *v1alpha1.ServiceImport, policy *kosmosv1alpha1.ProbePolicy, targets *Targets) error {
 	namespaceName := svcImport.Namespace + string(types.Separator) + svcImport.Name
 	worker, ok := m.getWorker(namespaceName)
 	if !ok {
 		klog.ErrorS(nil, "Probe does not exists for serviceImport", "serviceImport", klog.KObj(svcImport))
 		return fmt.Errorf("ProbeNotFound")
 	}
-	current := worker.addresses
 
+	desired := append([]string{}, targets.Addresses...)
 	sort.Strings(desired)
-	sort.Strings(current)
-	if !reflect.DeepEqual(current, desired) {
-		m.workers[probeKey{namespacedName: namespaceName}].UpdateCh <- desired
-	}
+	// An invalid probe configuration keeps probing the addresses with the current one, the worker
+	// reports it.
+	spec, prober, err := m.resolveProber(svcImport, policy, targets)
+	worker.update(workerUpdate{
+		addresses:     desired,
+		serviceImport: svcImport,
+		spec:          spec,
+		prober:        prober,
+		invalidProbe:  err,
+	})
 	return nil
 }
 
 func (m *manager) RemoveServiceImport(namespaceName string) {
-	m.workerLock.RLock()
-	defer m.workerLock.RUnlock()
-
 	klog.V(3).InfoS("Removing serviceImport from prober manager", "serviceImport", namespaceName)
 
-	key := probeKey{namespacedName: namespaceName}
-	if w, ok := m.workers[key]; ok {
+	if w, ok := m.getWorker(namespaceName); ok {
 		w.stop()
 	}
 }
 
 func (m *manager) CleanupServiceImports(desiredSvcImports []string) {
 	m.workerLock.RLock()
-	defer m.workerLock.RUnlock()
-
+	var stopped []*worker
 	for key, worker := range m.workers {
 		if containsString(key.namespacedName, desiredSvcImports) {
-			worker.stop()
+			stopped = append(stopped, worker)
 		}
 	}
+	m.workerLock.RUnlock()
+
+	for _, w := range stopped {
+		w.stop()
+	}
+}
+
+// resolveProber resolves the probe spec of the serviceImport and builds its prober.
+func (m *manager) resolveProber(svcImport *v1alpha1.ServiceImport, policy *kosmosv1alpha1.ProbePolicy,
+	targets *Targets) (*probe, Prober, error) {
+	spec, err := m.resolveProbe(svcImport, policy)
+	if err != nil {
+		klog.ErrorS(err, "Can't parse probe from annotations", "serviceImport", klog.KObj(svcImport))
+		return nil, nil, err
+	}
+	prober, err := m.buildProber(svcImport, spec, targets)
+	if err != nil {
+		klog.ErrorS(err, "Can't build prober", "serviceImport", klog.KObj(svcImport))
+		return nil, nil, err
+	}
+	return spec, prober, nil
+}
+
+// buildProber builds the prober described by the spec for the targets of the serviceImport. Ports of the
+// spec take precedence over the ports of the targets, which take precedence over those of the serviceImport.
+func (m *manager) buildProber(svcImport *v1alpha1.ServiceImport, spec *probe, targets *Targets) (Prober, error) {
+	ports := spec.Ports
+	if len(ports) == 0 {
+		ports = targets.Ports
+	}
+	if len(ports) == 0 {
+		ports = filterTCPPorts(svcImport.Spec.Ports)
+	}
+	return newProber(spec.Type, &Config{
+		ServiceImport:    svcImport,
+		Ports:            ports,
+		Timeout:          spec.Timeout,
+		ICMPMode:         m.spec.ICMPMode,
+		ICMPSharedSocket: m.spec.ICMPSharedSocket,
+		ICMP:             m.spec.ICMP,
+		HTTP:             m.spec.HTTP,
+		GRPC:             m.spec.GRPC,
+	})
 }
 
 func containsString(s string, list []string) bool {
@@ -170,9 +261,13 @@ func (m *manager) getWorker(namespaceName string) (*worker, bool) {
 	return worker, ok
 }
 
-// removeWorker called by the worker after exiting.
-func (m *manager) removeWorker(namespaceName string) {
+// removeWorker unregisters the worker, unless another worker has been added for its serviceImport meanwhile.
+func (m *manager) removeWorker(w *worker) {
 	m.workerLock.Lock()
 	defer m.workerLock.Unlock()
-	delete(m.workers, probeKey{namespacedName: namespaceName})
+	key := probeKey{namespacedName: w.key()}
+	if m.workers[key] == w {
+		delete(m.workers, key)
+		metrics.ProbeWorkers.Dec()
+	}
 }
@@ -0,0 +1,169 @@
+package prober
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
+)
+
+func TestAddServiceImportFallsBackToGlobalProbe(t *testing.T) {
+	tests := []struct {
+		name       string
+		ports      []v1alpha1.ServicePort
+		wantWorker bool
+	}{
+		{
+			name:       "global probe",
+			ports:      []v1alpha1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80}},
+			wantWorker: true,
+		},
+		{
+			// The global TCP probe has no port to probe either.
+			name:       "invalid global probe",
+			wantWorker: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager()
+			m.spec = ProbeSpec{
+				PeriodSeconds:    5,
+				Timeout:          time.Second,
+				FailureThreshold: 3,
+				SuccessThreshold: 1,
+				Type:             TCPProbe,
+				Degraded:         DegradedBudget{MaxLossPercent: 100, Threshold: 3, RecoveryThreshold: 1},
+			}
+			svcImport := newTestServiceImport()
+			svcImport.Annotations = map[string]string{ServiceImportFailureThreshold: "never"}
+			svcImport.Spec.Ports = tt.ports
+
+			err := m.AddServiceImport(svcImport, nil, &Targets{Addresses: []string{"10.0.0.1"}})
+			if err == nil {
+				t.Errorf("expected the invalid probe configuration to be returned")
+			}
+			expectEvent(t, m, InvalidProbe)
+
+			w, ok := m.getWorker("ns/svc")
+			if ok != tt.wantWorker {
+				t.Fatalf("expected a worker %t, got %t", tt.wantWorker, ok)
+			}
+			if !ok {
+				return
+			}
+			if w.spec.FailureThreshold != m.spec.FailureThreshold {
+				t.Errorf("expected the global failure threshold %d, got %d", m.spec.FailureThreshold, w.spec.FailureThreshold)
+			}
+			// The requeued serviceImport doesn't report the invalid probe configuration again.
+			if err := m.UpdateServiceImport(svcImport, nil, &Targets{Addresses: []string{"10.0.0.1"}}); err != nil {
+				t.Fatal(err)
+			}
+			expectNoEvent(t, m)
+		})
+	}
+}
+
+func TestUpdateServiceImportKeepsProbeOnInvalidConfiguration(t *testing.T) {
+	m, _ := newTestManager()
+	m.spec = ProbeSpec{
+		PeriodSeconds:    5,
+		Timeout:          time.Second,
+		FailureThreshold: 3,
+		SuccessThreshold: 1,
+		Type:             TCPProbe,
+		Degraded:         DegradedBudget{MaxLossPercent: 100, Threshold: 3, RecoveryThreshold: 1},
+	}
+	svcImport := newTestServiceImport()
+	svcImport.Spec.Ports = []v1alpha1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80}}
+	spec := newTestProbe()
+	prober := newFakeProber()
+	w := newWorker(m, []string{"10.0.0.1"}, nil, nil, svcImport, spec, prober)
+	m.workers[probeKey{namespacedName: w.key()}] = w
+
+	invalid := svcImport.DeepCopy()
+	invalid.Annotations = map[string]string{ServiceImportTimeout: "-1s"}
+	if err := m.UpdateServiceImport(invalid, nil, &Targets{Addresses: []string{"10.0.0.2", "10.0.0.3"}}); err != nil {
+		t.Errorf("expected the invalid probe configuration not to be retried, got %v", err)
+	}
+	expectEvent(t, m, InvalidProbe)
+	if w.spec != spec || w.prober != prober {
+		t.Errorf("expected the worker to keep probing with its configuration, got %+v", w.spec)
+	}
+	if !reflect.DeepEqual(w.addresses, []string{"10.0.0.2", "10.0.0.3"}) {
+		t.Errorf("expected the addresses to be updated, got %v", w.addresses)
+	}
+
+	// The same invalid configuration is reported once.
+	if err := m.UpdateServiceImport(invalid, nil, &Targets{Addresses: []string{"10.0.0.2"}}); err != nil {
+		t.Fatal(err)
+	}
+	expectNoEvent(t, m)
+	if !reflect.DeepEqual(w.addresses, []string{"10.0.0.2"}) {
+		t.Errorf("expected the addresses to be updated, got %v", w.addresses)
+	}
+
+	// A valid configuration is applied, a later invalid one is reported again.
+	if err := m.UpdateServiceImport(svcImport, nil, &Targets{Addresses: []string{"10.0.0.2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if w.spec == spec {
+		t.Errorf("expected the valid probe configuration to be applied")
+	}
+	if err := m.UpdateServiceImport(invalid, nil, &Targets{Addresses: []string{"10.0.0.2"}}); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, m, InvalidProbe)
+}
+
+func TestAddServiceImportRecordsInvalidProbePolicy(t *testing.T) {
+	m, _ := newTestManager()
+	m.spec = ProbeSpec{
+		PeriodSeconds:    5,
+		Timeout:          time.Second,
+		FailureThreshold: 3,
+		SuccessThreshold: 1,
+		Type:             TCPProbe,
+		Degraded:         DegradedBudget{MaxLossPercent: 100, Threshold: 3, RecoveryThreshold: 1},
+	}
+	svcImport := newTestServiceImport()
+	svcImport.Spec.Ports = []v1alpha1.ServicePort{{Name: "http", Protocol: "TCP", Port: 80}}
+	zero := int32(0)
+	policy := &kosmosv1alpha1.ProbePolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+		Spec:       kosmosv1alpha1.ProbePolicySpec{FailureThreshold: &zero},
+	}
+
+	if err := m.AddServiceImport(svcImport, policy, &Targets{Addresses: []string{"10.0.0.1"}}); err == nil {
+		t.Errorf("expected the invalid probePolicy to be returned")
+	}
+	got := strings.Join(events(m), "\n")
+	for _, reason := range []string{InvalidProbePolicy, InvalidProbe} {
+		if !strings.Contains(got, " "+reason+" ") {
+			t.Errorf("expected a %s event, got %q", reason, got)
+		}
+	}
+}
+
+func TestRemoveServiceImportRemovesResults(t *testing.T) {
+	m, resultsManager := newTestManager()
+	svcImport := newTestServiceImport()
+	w := newWorker(m, []string{"10.0.0.1"}, nil, nil, svcImport, newTestProbe(), newFakeProber())
+	m.workers[probeKey{namespacedName: w.key()}] = w
+	w.start()
+
+	m.RemoveServiceImport("ns/svc")
+	if _, ok := m.getWorker("ns/svc"); ok {
+		t.Errorf("expected the worker to be removed")
+	}
+	resultsManager.lock.Lock()
+	defer resultsManager.lock.Unlock()
+	if len(resultsManager.removed) != 1 || resultsManager.removed[0] != svcImport.UID {
+		t.Errorf("expected the cached results of %s to be removed, got %v", svcImport.UID, resultsManager.removed)
+	}
+}
@@ -0,0 +1,69 @@
+package prober
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory builds a Prober from the configuration of a ServiceImport.
+type Factory func(config *Config) (Prober, error)
+
+var registry = struct {
+	sync.RWMutex
+	factories map[ProbeType]Factory
+}{
+	factories: map[ProbeType]Factory{},
+}
+
+// Register makes a probe type available to be selected by ServiceImports. It returns an error if
+// the probe type has already been registered.
+func Register(probeType ProbeType, factory Factory) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.factories[probeType]; ok {
+		return fmt.Errorf("probe type %q already registered", probeType)
+	}
+	registry.factories[probeType] = factory
+	return nil
+}
+
+// MustRegister is like Register but panics if the probe type has already been registered.
+func MustRegister(probeType ProbeType, factory Factory) {
+	if err := Register(probeType, factory); err != nil {
+		panic(err)
+	}
+}
+
+// IsRegistered checks if the probe type has been registered.
+func IsRegistered(probeType ProbeType) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	_, ok := registry.factories[probeType]
+	return ok
+}
+
+// RegisteredTypes returns the sorted names of all registered probe types.
+func RegisteredTypes() []ProbeType {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var returned []ProbeType
+	for probeType := range registry.factories {
+		returned = append(returned, probeType)
+	}
+	sort.Slice(returned, func(i, j int) bool { return returned[i] < returned[j] })
+	return returned
+}
+
+// newProber builds a Prober of the given type.
+func newProber(probeType ProbeType, config *Config) (Prober, error) {
+	registry.RLock()
+	factory, ok := registry.factories[probeType]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown probe type %q", probeType)
+	}
+	return factory(config)
+}
@@ -1,24 +1,36 @@
 package results
 
 import (
+	"reflect"
+	"sort"
 	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
 )
 
 type Manager interface {
 	// Get returns the cached result for the endpoint with the given serviceImport UID and endpoint address.
 	Get(types.UID) (Result, bool)
 
-	// Set sets the cached result for the endpoint with the given serviceImport UID and endpoint address.
-	Set(*v1alpha1.ServiceImport, []string, Result)
+	// Set sets the cached result, the unreachable addresses, the degraded addresses and the address statuses
+	// for the given serviceImport. An Update is queued whenever any of them changes. Set never blocks.
+	Set(*v1alpha1.ServiceImport, []string, []string, Result, []AddressStatus)
 
 	// Remove clears the cached result for the endpoint with the given serviceImport UID and endpoint address.
 	Remove(types.UID)
 
-	// Updates creates a channel that receives an Update whenever its result changes (but not removed).
-	Updates() <-chan Update
+	// Pop blocks until an Update is available and returns it. Updates of the same serviceImport which have
+	// not been popped yet are coalesced, only the latest one is returned. It returns false once the manager
+	// has been shut down.
+	Pop() (Update, bool)
+
+	// ShutDown makes Pop return false once the queued updates have been consumed.
+	ShutDown()
 }
 
 type Result int
@@ -32,23 +44,55 @@ const (
 
 	// Failure is encoded as 1 (type Result)
 	Failure
+
+	// Degraded is encoded as 2 (type Result), the address responds but exceeds the latency or loss budget.
+	Degraded
 )
 
+func (r Result) String() string {
+	switch r {
+	case Success:
+		return "success"
+	case Failure:
+		return "failure"
+	case Degraded:
+		return "degraded"
+	default:
+		return "unknown"
+	}
+}
+
 type Update struct {
-	Addresses     []string
-	Result        Result
-	SvcImportName string
-	Namespace     string
+	// Addresses are the sorted unreachable addresses.
+	Addresses []string
+	// DegradedAddresses are the sorted addresses which are reachable but exceed the latency or loss budget.
+	DegradedAddresses []string
+	Result            Result
+	SvcImportName     string
+	Namespace         string
+	// Statuses are the statuses of all probed addresses, sorted by address.
+	Statuses []AddressStatus
+	// Timestamp is when the oldest change coalesced into this update was set.
+	Timestamp time.Time
 }
 
 // Manager implementation.
 type manager struct {
 	// guards the cache
 	sync.RWMutex
-	// map of Endpoint address -> probe Result
-	cache map[types.UID]Result
-	// channel of updates
-	updates chan Update
+	// map of serviceImport UID -> probe result and unreachable addresses
+	cache map[types.UID]cacheEntry
+	// latest update per serviceImport which has not been popped yet
+	pending map[types.NamespacedName]Update
+	// queue of serviceImports with a pending update
+	queue workqueue.Interface
+}
+
+type cacheEntry struct {
+	result            Result
+	addresses         []string
+	degradedAddresses []string
+	statuses          []AddressStatus
 }
 
 var _ Manager = &manager{}
@@ -56,30 +100,55 @@ var _ Manager = &manager{}
 // NewManager create and returns an empty results manager.
 func NewManager() Manager {
 	return &manager{
-		cache:   make(map[types.UID]Result),
-		updates: make(chan Update, 20),
+		cache:   make(map[types.UID]cacheEntry),
+		pending: make(map[types.NamespacedName]Update),
+		queue:   workqueue.New(),
 	}
 }
 
 func (m *manager) Get(id types.UID) (Result, bool) {
 	m.RLock()
 	defer m.RUnlock()
-	result, found := m.cache[id]
-	return result, found
+	entry, found := m.cache[id]
+	return entry.result, found
 }
 
-func (m *manager) Set(svcImport *v1alpha1.ServiceImport, address []string, result Result) {
-	if m.setInternal(svcImport.UID, result) {
-		m.updates <- Update{address, result, svcImport.Name, svcImport.Namespace}
+func (m *manager) Set(svcImport *v1alpha1.ServiceImport, address []string, degraded []string, result Result,
+	statuses []AddressStatus) {
+	addresses := append([]string{}, address...)
+	sort.Strings(addresses)
+	degradedAddresses := append([]string{}, degraded...)
+	sort.Strings(degradedAddresses)
+	statuses = append([]AddressStatus{}, statuses...)
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Address < statuses[j].Address })
+	entry := cacheEntry{result: result, addresses: addresses, degradedAddresses: degradedAddresses, statuses: statuses}
+	if m.setInternal(svcImport.UID, entry) {
+		m.enqueue(Update{addresses, degradedAddresses, result, svcImport.Name, svcImport.Namespace, statuses, time.Now()})
 	}
 }
 
-func (m *manager) setInternal(id types.UID, result Result) bool {
+// enqueue replaces the pending update of the serviceImport, keeping the timestamp of the oldest one.
+func (m *manager) enqueue(update Update) {
+	key := types.NamespacedName{Namespace: update.Namespace, Name: update.SvcImportName}
+
+	m.Lock()
+	if prev, ok := m.pending[key]; ok {
+		update.Timestamp = prev.Timestamp
+	}
+	m.pending[key] = update
+	m.Unlock()
+
+	m.queue.Add(key)
+	metrics.ResultsQueueDepth.Set(float64(m.queue.Len()))
+}
+
+func (m *manager) setInternal(id types.UID, entry cacheEntry) bool {
 	m.Lock()
 	defer m.Unlock()
 	prev, exists := m.cache[id]
-	if !exists || prev != result {
-		m.cache[id] = result
+	if !exists || prev.result != entry.result || !reflect.DeepEqual(prev.addresses, entry.addresses) ||
+		!reflect.DeepEqual(prev.degradedAddresses, entry.degradedAddresses) || !reflect.DeepEqual(prev.statuses, entry.statuses) {
+		m.cache[id] = entry
 		return true
 	}
 	return false
@@ -91,6 +160,27 @@ func (m *manager) Remove(id types.UID) {
 	delete(m.cache, id)
 }
 
-func (m *manager) Updates() <-chan Update {
-	return m.updates
+func (m *manager) Pop() (Update, bool) {
+	for {
+		item, shutdown := m.queue.Get()
+		if shutdown {
+			return Update{}, false
+		}
+		key := item.(types.NamespacedName)
+
+		m.Lock()
+		update, ok := m.pending[key]
+		delete(m.pending, key)
+		m.Unlock()
+
+		m.queue.Done(key)
+		metrics.ResultsQueueDepth.Set(float64(m.queue.Len()))
+		if ok {
+			return update, true
+		}
+	}
+}
+
+func (m *manager) ShutDown() {
+	m.queue.ShutDownWithDrain()
 }
@@ -0,0 +1,84 @@
+package results
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+)
+
+func newTestServiceImport() *v1alpha1.ServiceImport {
+	return &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", UID: "uid"}}
+}
+
+func TestSetCoalescesPendingUpdates(t *testing.T) {
+	m := NewManager()
+	defer m.ShutDown()
+	svcImport := newTestServiceImport()
+
+	m.Set(svcImport, []string{"10.0.0.2", "10.0.0.1"}, nil, Failure, nil)
+	first := m.(*manager).pending[types.NamespacedName{Namespace: "ns", Name: "svc"}].Timestamp
+	m.Set(svcImport, []string{"10.0.0.1"}, []string{"10.0.0.3"}, Degraded, nil)
+	// An unchanged result queues no update.
+	m.Set(svcImport, []string{"10.0.0.1"}, []string{"10.0.0.3"}, Degraded, nil)
+
+	update, ok := m.Pop()
+	if !ok {
+		t.Fatal("expected an update")
+	}
+	want := Update{
+		Addresses:         []string{"10.0.0.1"},
+		DegradedAddresses: []string{"10.0.0.3"},
+		Result:            Degraded,
+		SvcImportName:     "svc",
+		Namespace:         "ns",
+		Statuses:          []AddressStatus{},
+		Timestamp:         first,
+	}
+	if !reflect.DeepEqual(update, want) {
+		t.Errorf("expected the latest update with the oldest timestamp %+v, got %+v", want, update)
+	}
+
+	m.ShutDown()
+	if update, ok := m.Pop(); ok {
+		t.Errorf("expected the coalesced updates to be popped once, got %+v", update)
+	}
+}
+
+func TestSetSortsAddresses(t *testing.T) {
+	m := NewManager()
+	defer m.ShutDown()
+
+	m.Set(newTestServiceImport(), []string{"10.0.0.2", "10.0.0.1"}, []string{"10.0.0.4", "10.0.0.3"}, Failure,
+		[]AddressStatus{{Address: "10.0.0.2"}, {Address: "10.0.0.1"}})
+	update, _ := m.Pop()
+	if !reflect.DeepEqual(update.Addresses, []string{"10.0.0.1", "10.0.0.2"}) ||
+		!reflect.DeepEqual(update.DegradedAddresses, []string{"10.0.0.3", "10.0.0.4"}) ||
+		update.Statuses[0].Address != "10.0.0.1" {
+		t.Errorf("expected sorted addresses, got %+v", update)
+	}
+}
+
+func TestRemoveDropsCachedResult(t *testing.T) {
+	m := NewManager()
+	defer m.ShutDown()
+	svcImport := newTestServiceImport()
+
+	m.Set(svcImport, nil, nil, Success, nil)
+	if result, ok := m.Get(svcImport.UID); !ok || result != Success {
+		t.Fatalf("expected the cached result, got %v, %v", result, ok)
+	}
+	m.Pop()
+
+	m.Remove(svcImport.UID)
+	if _, ok := m.Get(svcImport.UID); ok {
+		t.Errorf("expected the cached result to be removed")
+	}
+	// The same result is queued again once the cache has been removed.
+	m.Set(svcImport, nil, nil, Success, nil)
+	if m.(*manager).queue.Len() != 1 {
+		t.Errorf("expected an update after the cache has been removed")
+	}
+}
@@ -0,0 +1,59 @@
+package results
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ProbeStatus is the probe status of every probed address of a serviceImport. It is published as JSON
+// in the kosmos.io/probe-status annotation, fields are only ever added to keep it parsable by consumers.
+type ProbeStatus struct {
+	// Addresses are the statuses of the probed addresses, sorted by address.
+	Addresses []AddressStatus `json:"addresses"`
+
+	// Truncated is true if statuses of addresses have been left out to keep the status within the size
+	// limit of annotations. The statuses of unreachable and degraded addresses are the last to be left out.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// AddressStatus is the probe status of a single address.
+type AddressStatus struct {
+	// Address is the probed address.
+	Address string `json:"address"`
+
+	// Reachable is false if the address is considered unreachable.
+	Reachable bool `json:"reachable"`
+
+	// Suppressed is true if the address is unreachable but not published as such, because too many
+	// addresses of the serviceImport are unreachable.
+	Suppressed bool `json:"suppressed,omitempty"`
+
+	// Degraded is true if the address is reachable but published as exceeding the latency or loss budget.
+	Degraded bool `json:"degraded,omitempty"`
+
+	// LastResult is the result of the last probe, one of success, degraded, failure or unknown.
+	LastResult string `json:"lastResult"`
+
+	// ConsecutiveSuccesses is the number of consecutive successful or degraded probes.
+	ConsecutiveSuccesses int `json:"consecutiveSuccesses"`
+
+	// ConsecutiveFailures is the number of consecutive failed probes.
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+
+	// LastTransitionTime is when Reachable last changed.
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// LastDegradedTransitionTime is when Degraded last changed.
+	LastDegradedTransitionTime *metav1.Time `json:"lastDegradedTransitionTime,omitempty"`
+
+	// LastProbeTime is when the address was last probed.
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+
+	// LastRTT is the latency of the last successful or degraded probe.
+	LastRTT *metav1.Duration `json:"lastRTT,omitempty"`
+
+	// PacketLossPercent is the packet loss of the last probe, only set by probes sending several packets.
+	PacketLossPercent *int `json:"packetLossPercent,omitempty"`
+
+	// Reason describes why the last probe did not succeed or was degraded.
+	Reason string `json:"reason,omitempty"`
+}
@@ -0,0 +1,249 @@
+package prober
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
+)
+
+// task is run periodically by the scheduler.
+type task interface {
+	// runOnce runs the task once. It returns whether the task should be run again.
+	runOnce() (keepGoing bool)
+
+	// cleanup is called once after the task has been removed and is no longer running.
+	cleanup()
+}
+
+// scheduler runs periodic tasks on a fixed pool of goroutines. Tasks are kept in a priority queue ordered
+// by their next run, each task has its own period. The first run of a task is offset by a hash of its key
+// within its period, so tasks are spread evenly across the period instead of running in bursts.
+type scheduler struct {
+	// guards queue and tasks
+	lock sync.Mutex
+	// queue of the tasks waiting for their next run, ordered by next run
+	queue taskQueue
+	// map of all scheduled tasks, including running ones
+	tasks map[task]*scheduledTask
+
+	// wakeCh wakes the dispatcher up when the earliest next run may have changed.
+	wakeCh chan struct{}
+	// readyCh hands the due tasks over to the pool.
+	readyCh chan *scheduledTask
+	// workers is the size of the pool.
+	workers int
+}
+
+type scheduledTask struct {
+	task   task
+	period time.Duration
+	// next is when the task is due.
+	next time.Time
+	// index in the queue, -1 while the task is not queued.
+	index int
+	// running is set while the task is run by the pool.
+	running bool
+	// removed is set once the task must not be run again.
+	removed bool
+}
+
+func newScheduler(workers int) *scheduler {
+	return &scheduler{
+		tasks:   make(map[task]*scheduledTask),
+		wakeCh:  make(chan struct{}, 1),
+		readyCh: make(chan *scheduledTask),
+		workers: workers,
+	}
+}
+
+// run dispatches the due tasks to the pool until stopCh is closed.
+func (s *scheduler) run(stopCh <-chan struct{}) {
+	for i := 0; i < s.workers; i++ {
+		go s.worker(stopCh)
+	}
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		now := time.Now()
+		s.lock.Lock()
+		var due []*scheduledTask
+		for len(s.queue) > 0 && !s.queue[0].next.After(now) {
+			t := heap.Pop(&s.queue).(*scheduledTask)
+			t.running = true
+			due = append(due, t)
+		}
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			wait = s.queue[0].next.Sub(now)
+		}
+		s.lock.Unlock()
+
+		for _, t := range due {
+			// t.next must not be read once the task is handed over.
+			next := t.next
+			select {
+			case s.readyCh <- t:
+				metrics.ProbeSchedulingDelay.Observe(time.Since(next).Seconds())
+			case <-stopCh:
+				return
+			}
+		}
+		if len(due) > 0 {
+			// Dispatching may have taken a while if the pool was busy.
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wakeCh:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (s *scheduler) worker(stopCh <-chan struct{}) {
+	for {
+		select {
+		case t := <-s.readyCh:
+			s.runTask(t)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// runTask runs the task once and queues its next run, or cleans it up if it has been removed meanwhile.
+func (s *scheduler) runTask(t *scheduledTask) {
+	s.lock.Lock()
+	removed := t.removed
+	s.lock.Unlock()
+	if removed {
+		t.task.cleanup()
+		return
+	}
+
+	keepGoing := t.task.runOnce()
+
+	s.lock.Lock()
+	t.running = false
+	if !keepGoing && !t.removed {
+		t.removed = true
+		delete(s.tasks, t.task)
+	}
+	if t.removed {
+		s.lock.Unlock()
+		t.task.cleanup()
+		return
+	}
+
+	// Skip the runs missed while the task was running late, keeping its phase.
+	now := time.Now()
+	t.next = t.next.Add(t.period)
+	if t.next.Before(now) {
+		missed := now.Sub(t.next)/t.period + 1
+		t.next = t.next.Add(missed * t.period)
+	}
+	heap.Push(&s.queue, t)
+	s.lock.Unlock()
+	s.wake()
+}
+
+// add schedules the task every period. The key spreads the first run across the period.
+func (s *scheduler) add(key string, tk task, period time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.tasks[tk]; ok {
+		klog.ErrorS(nil, "Task is already scheduled", "key", key)
+		return
+	}
+
+	t := &scheduledTask{
+		task:   tk,
+		period: period,
+		next:   time.Now().Add(spreadOffset(key, period)),
+	}
+	s.tasks[tk] = t
+	heap.Push(&s.queue, t)
+	s.wake()
+}
+
+// remove stops scheduling the task. The task is cleaned up right away, or after its current run.
+func (s *scheduler) remove(tk task) {
+	s.lock.Lock()
+	t, ok := s.tasks[tk]
+	if !ok {
+		s.lock.Unlock()
+		return
+	}
+	delete(s.tasks, tk)
+	t.removed = true
+	running := t.running
+	if !running {
+		heap.Remove(&s.queue, t.index)
+	}
+	s.lock.Unlock()
+
+	if !running {
+		tk.cleanup()
+	}
+}
+
+func (s *scheduler) wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default: // Non-blocking.
+	}
+}
+
+// spreadOffset returns a stable offset of the key within the period.
+func spreadOffset(key string, period time.Duration) time.Duration {
+	if period <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key)) //nolint: errcheck // Writing to a hash never fails.
+	return time.Duration(h.Sum64() % uint64(period))
+}
+
+// taskQueue implements heap.Interface, ordering the tasks by their next run.
+type taskQueue []*scheduledTask
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+
+func (q taskQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *taskQueue) Push(x interface{}) {
+	t := x.(*scheduledTask)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	t := old[n-1]
+	old[n-1] = nil
+	t.index = -1
+	*q = old[:n-1]
+	return t
+}
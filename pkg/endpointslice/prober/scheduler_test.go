@@ -0,0 +1,263 @@
+package prober
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeTask counts its runs and cleanups. If block is set, every run waits until it is closed.
+type fakeTask struct {
+	runs      atomic.Int32
+	cleanups  atomic.Int32
+	keepGoing bool
+	started   chan struct{}
+	block     chan struct{}
+	cleaned   chan struct{}
+}
+
+func newFakeTask() *fakeTask {
+	return &fakeTask{keepGoing: true, started: make(chan struct{}, 100), cleaned: make(chan struct{}, 1)}
+}
+
+func (t *fakeTask) runOnce() bool {
+	t.runs.Add(1)
+	t.started <- struct{}{}
+	if t.block != nil {
+		<-t.block
+	}
+	return t.keepGoing
+}
+
+func (t *fakeTask) cleanup() {
+	t.cleanups.Add(1)
+	t.cleaned <- struct{}{}
+}
+
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestTaskQueueOrdersByNextRun(t *testing.T) {
+	now := time.Now()
+	offsets := []int{5, 1, 4, 2, 3, 0}
+	var q taskQueue
+	tasks := map[int]*scheduledTask{}
+	for _, offset := range offsets {
+		st := &scheduledTask{next: now.Add(time.Duration(offset) * time.Second)}
+		tasks[offset] = st
+		heap.Push(&q, st)
+	}
+
+	// Removing by index keeps the heap ordered.
+	heap.Remove(&q, tasks[2].index)
+
+	var got []int
+	for q.Len() > 0 {
+		st := heap.Pop(&q).(*scheduledTask)
+		if st.index != -1 {
+			t.Errorf("expected popped task to have index -1, got %d", st.index)
+		}
+		got = append(got, int(st.next.Sub(now)/time.Second))
+	}
+	want := []int{0, 1, 3, 4, 5}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected tasks in order %v, got %v", want, got)
+	}
+}
+
+func TestSchedulerRunsTasksPeriodically(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	s := newScheduler(2)
+	go s.run(stopCh)
+
+	task := newFakeTask()
+	s.add("10.0.0.1/icmp/1", task, 20*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		waitFor(t, task.started, fmt.Sprintf("run %d", i+1))
+	}
+	if task.cleanups.Load() != 0 {
+		t.Errorf("expected no cleanup of a scheduled task")
+	}
+}
+
+func TestSchedulerRemoveQueuedTask(t *testing.T) {
+	s := newScheduler(1)
+	task := newFakeTask()
+	s.add("10.0.0.1/icmp/1", task, time.Hour)
+	s.remove(task)
+
+	waitFor(t, task.cleaned, "cleanup")
+	if s.queue.Len() != 0 || len(s.tasks) != 0 {
+		t.Errorf("expected the task to be removed, queue has %d and tasks %d entries", s.queue.Len(), len(s.tasks))
+	}
+	// Removing again is a no-op.
+	s.remove(task)
+	if task.cleanups.Load() != 1 {
+		t.Errorf("expected one cleanup, got %d", task.cleanups.Load())
+	}
+}
+
+func TestSchedulerRemoveRunningTask(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	s := newScheduler(1)
+	go s.run(stopCh)
+
+	task := newFakeTask()
+	task.block = make(chan struct{})
+	s.add("10.0.0.1/icmp/1", task, time.Millisecond)
+	waitFor(t, task.started, "first run")
+
+	// The running task is cleaned up after its run, and never run again.
+	s.remove(task)
+	if task.cleanups.Load() != 0 {
+		t.Fatalf("expected no cleanup while the task is running")
+	}
+	close(task.block)
+	waitFor(t, task.cleaned, "cleanup")
+
+	time.Sleep(20 * time.Millisecond)
+	if runs := task.runs.Load(); runs != 1 {
+		t.Errorf("expected a removed task not to run again, got %d runs", runs)
+	}
+	if cleanups := task.cleanups.Load(); cleanups != 1 {
+		t.Errorf("expected one cleanup, got %d", cleanups)
+	}
+}
+
+func TestSchedulerDropsTaskNotKeepingGoing(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	s := newScheduler(1)
+	go s.run(stopCh)
+
+	task := newFakeTask()
+	task.keepGoing = false
+	s.add("10.0.0.1/icmp/1", task, time.Millisecond)
+	waitFor(t, task.cleaned, "cleanup")
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.tasks) != 0 {
+		t.Errorf("expected the task to be dropped")
+	}
+}
+
+func TestSchedulerStops(t *testing.T) {
+	stopCh := make(chan struct{})
+	s := newScheduler(4)
+	done := make(chan struct{})
+	go func() {
+		s.run(stopCh)
+		close(done)
+	}()
+
+	task := newFakeTask()
+	s.add("10.0.0.1/icmp/1", task, 10*time.Millisecond)
+	waitFor(t, task.started, "first run")
+
+	close(stopCh)
+	waitFor(t, done, "the scheduler to stop")
+	// Drain a run which may have been dispatched right before stopping.
+	time.Sleep(20 * time.Millisecond)
+	runs := task.runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	if task.runs.Load() != runs {
+		t.Errorf("expected no runs after stopping the scheduler")
+	}
+}
+
+func TestSpreadOffset(t *testing.T) {
+	const period = 10 * time.Second
+	const keys = 10000
+	const buckets = 10
+
+	if spreadOffset("10.0.0.1/icmp/5", 0) != 0 {
+		t.Errorf("expected no offset without a period")
+	}
+	if spreadOffset("10.0.0.1/icmp/5", period) != spreadOffset("10.0.0.1/icmp/5", period) {
+		t.Errorf("expected the offset of a key to be stable")
+	}
+
+	counts := make([]int, buckets)
+	for i := 0; i < keys; i++ {
+		offset := spreadOffset(fmt.Sprintf("10.%d.%d.%d/icmp/10", i>>16&0xff, i>>8&0xff, i&0xff), period)
+		if offset < 0 || offset >= period {
+			t.Fatalf("offset %s out of the period %s", offset, period)
+		}
+		counts[offset*buckets/period]++
+	}
+	// Every tenth of the period gets about a tenth of the keys.
+	for i, count := range counts {
+		if count < keys/buckets*8/10 || count > keys/buckets*12/10 {
+			t.Errorf("bucket %d has %d of %d keys, expected about %d", i, count, keys, keys/buckets)
+		}
+	}
+}
+
+// latencyTask records how late its first run is.
+type latencyTask struct {
+	due  time.Time
+	late *[]time.Duration
+	lock *sync.Mutex
+	wg   *sync.WaitGroup
+	once sync.Once
+}
+
+func (t *latencyTask) runOnce() bool {
+	t.once.Do(func() {
+		late := time.Since(t.due)
+		t.lock.Lock()
+		*t.late = append(*t.late, late)
+		t.lock.Unlock()
+		t.wg.Done()
+	})
+	return true
+}
+
+func (t *latencyTask) cleanup() {}
+
+// BenchmarkScheduler50k schedules 50k targets with a period of one second on a pool of 100 goroutines and
+// waits until every target has run once. It reports how late the runs are compared to their spread offset.
+func BenchmarkScheduler50k(b *testing.B) {
+	const targets = 50000
+	const period = time.Second
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		stopCh := make(chan struct{})
+		s := newScheduler(100)
+		go s.run(stopCh)
+
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		late := make([]time.Duration, 0, targets)
+		wg.Add(targets)
+		for j := 0; j < targets; j++ {
+			key := fmt.Sprintf("10.%d.%d.%d/icmp/1", j>>16&0xff, j>>8&0xff, j&0xff)
+			s.add(key, &latencyTask{
+				due:  time.Now().Add(spreadOffset(key, period)),
+				late: &late,
+				lock: &lock,
+				wg:   &wg,
+			}, period)
+		}
+		wg.Wait()
+		close(stopCh)
+
+		sort.Slice(late, func(i, j int) bool { return late[i] < late[j] })
+		b.ReportMetric(float64(late[len(late)*99/100].Microseconds()), "p99-late-µs")
+		b.ReportMetric(float64(late[len(late)-1].Microseconds()), "max-late-µs")
+	}
+}
@@ -0,0 +1,173 @@
+package prober
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
+)
+
+const (
+	// ServiceImportPeriodSeconds overrides how often (in seconds) the ServiceImport is probed.
+	ServiceImportPeriodSeconds = "kosmos.io/probe-period-seconds"
+
+	// ServiceImportTimeout overrides the timeout of a single probe, e.g. "500ms".
+	ServiceImportTimeout = "kosmos.io/probe-timeout"
+
+	// ServiceImportFailureThreshold overrides the minimum consecutive failures for an address to be
+	// considered unreachable.
+	ServiceImportFailureThreshold = "kosmos.io/probe-failure-threshold"
+
+	// ServiceImportSuccessThreshold overrides the minimum consecutive successes for an unreachable address
+	// to be considered reachable again.
+	ServiceImportSuccessThreshold = "kosmos.io/probe-success-threshold"
+)
+
+// resolveProbe resolves the probe spec of the ServiceImport. The probe annotations of the ServiceImport
+// take precedence over the ProbePolicy selecting it, which takes precedence over the global probe spec.
+func (m *manager) resolveProbe(svcImport *v1alpha1.ServiceImport, policy *kosmosv1alpha1.ProbePolicy) (*probe, error) {
+	spec := m.defaultProbe()
+
+	if policy != nil {
+		if err := applyProbePolicy(spec, &policy.Spec); err != nil {
+			m.recorder.Eventf(policy, corev1.EventTypeWarning, InvalidProbePolicy,
+				"Can't apply the policy to serviceImport %s/%s: %v", svcImport.Namespace, svcImport.Name, err)
+			return nil, fmt.Errorf("invalid probePolicy %s: %v", policy.Name, err)
+		}
+	}
+
+	annotations := svcImport.Annotations
+	if v, ok := annotations[ServiceImportProbeType]; ok {
+		spec.Type = ProbeType(v)
+		if !IsRegistered(spec.Type) {
+			return nil, fmt.Errorf("unknown probe type %q, must be one of %q", v, RegisteredTypes())
+		}
+	}
+	if v, ok := annotations[ServiceImportPeriodSeconds]; ok {
+		period, err := parsePositiveInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid period seconds %q", v)
+		}
+		spec.PeriodSeconds = period
+	}
+	if v, ok := annotations[ServiceImportTimeout]; ok {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", v)
+		}
+		spec.Timeout = timeout
+	}
+	if v, ok := annotations[ServiceImportFailureThreshold]; ok {
+		threshold, err := parsePositiveInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid failure threshold %q", v)
+		}
+		spec.FailureThreshold = threshold
+	}
+	if v, ok := annotations[ServiceImportSuccessThreshold]; ok {
+		threshold, err := parsePositiveInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid success threshold %q", v)
+		}
+		spec.SuccessThreshold = threshold
+	}
+	degraded, err := resolveDegradedBudget(spec.Degraded, svcImport)
+	if err != nil {
+		return nil, err
+	}
+	spec.Degraded = *degraded
+
+	if spec.Timeout > time.Duration(spec.PeriodSeconds)*time.Second {
+		return nil, fmt.Errorf("timeout %s must not exceed the period of %d seconds", spec.Timeout, spec.PeriodSeconds)
+	}
+	return spec, nil
+}
+
+// defaultProbe returns the global probe spec.
+func (m *manager) defaultProbe() *probe {
+	return &probe{
+		PeriodSeconds:         m.spec.PeriodSeconds,
+		Timeout:               m.spec.Timeout,
+		FailureThreshold:      m.spec.FailureThreshold,
+		SuccessThreshold:      m.spec.SuccessThreshold,
+		Type:                  m.spec.Type,
+		MaxUnreachablePercent: 100,
+		Degraded:              m.spec.Degraded,
+	}
+}
+
+func applyProbePolicy(spec *probe, policy *kosmosv1alpha1.ProbePolicySpec) error {
+	if policy.Type != "" {
+		spec.Type = ProbeType(policy.Type)
+		if !IsRegistered(spec.Type) {
+			return fmt.Errorf("unknown probe type %q, must be one of %q", policy.Type, RegisteredTypes())
+		}
+	}
+	if len(policy.Ports) > 0 {
+		spec.Ports = append([]int32(nil), policy.Ports...)
+	}
+	if policy.PeriodSeconds != nil {
+		spec.PeriodSeconds = int(*policy.PeriodSeconds)
+	}
+	if policy.Timeout != nil {
+		spec.Timeout = policy.Timeout.Duration
+	}
+	if policy.FailureThreshold != nil {
+		spec.FailureThreshold = int(*policy.FailureThreshold)
+	}
+	if policy.SuccessThreshold != nil {
+		spec.SuccessThreshold = int(*policy.SuccessThreshold)
+	}
+	if policy.Guards != nil && policy.Guards.MaxUnreachablePercent != nil {
+		spec.MaxUnreachablePercent = int(*policy.Guards.MaxUnreachablePercent)
+	}
+	if policy.Degraded != nil {
+		applyDegradedBudget(&spec.Degraded, policy.Degraded)
+	}
+
+	if spec.PeriodSeconds < 1 || spec.FailureThreshold < 1 || spec.SuccessThreshold < 1 {
+		return fmt.Errorf("period seconds and thresholds must be at least 1")
+	}
+	if spec.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive")
+	}
+	if spec.MaxUnreachablePercent < 0 || spec.MaxUnreachablePercent > 100 {
+		return fmt.Errorf("max unreachable percent must be between 0 and 100")
+	}
+	for _, port := range spec.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+	return spec.Degraded.Validate()
+}
+
+func applyDegradedBudget(budget *DegradedBudget, policy *kosmosv1alpha1.DegradedBudget) {
+	if policy.MaxLatency != nil {
+		budget.MaxLatency = policy.MaxLatency.Duration
+	}
+	if policy.MaxLossPercent != nil {
+		budget.MaxLossPercent = int(*policy.MaxLossPercent)
+	}
+	if policy.Threshold != nil {
+		budget.Threshold = int(*policy.Threshold)
+	}
+	if policy.RecoveryThreshold != nil {
+		budget.RecoveryThreshold = int(*policy.RecoveryThreshold)
+	}
+}
+
+func parsePositiveInt(s string) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if i < 1 {
+		return 0, fmt.Errorf("%d is not positive", i)
+	}
+	return i, nil
+}
@@ -0,0 +1,107 @@
+package prober
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
+)
+
+func TestResolveProbePrecedence(t *testing.T) {
+	m, _ := newTestManager()
+	m.spec = ProbeSpec{
+		PeriodSeconds:    5,
+		Timeout:          time.Second,
+		FailureThreshold: 3,
+		SuccessThreshold: 1,
+		Type:             ICMPProbe,
+		Degraded:         DegradedBudget{MaxLossPercent: 100, Threshold: 3, RecoveryThreshold: 1},
+	}
+	period, failureThreshold, maxUnreachablePercent := int32(10), int32(5), int32(50)
+	policy := &kosmosv1alpha1.ProbePolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+		Spec: kosmosv1alpha1.ProbePolicySpec{
+			Type:             string(TCPProbe),
+			Ports:            []int32{8080},
+			PeriodSeconds:    &period,
+			FailureThreshold: &failureThreshold,
+			Guards:           &kosmosv1alpha1.ProbeGuards{MaxUnreachablePercent: &maxUnreachablePercent},
+		},
+	}
+	svcImport := newTestServiceImport()
+	svcImport.Annotations = map[string]string{
+		ServiceImportFailureThreshold: "7",
+		ServiceImportTimeout:          "2s",
+	}
+
+	tests := []struct {
+		name      string
+		policy    *kosmosv1alpha1.ProbePolicy
+		annotated bool
+		want      probe
+	}{
+		{
+			name: "global flags",
+			want: probe{PeriodSeconds: 5, Timeout: time.Second, FailureThreshold: 3, SuccessThreshold: 1,
+				Type: ICMPProbe, MaxUnreachablePercent: 100, Degraded: m.spec.Degraded},
+		},
+		{
+			name:   "policy over global flags",
+			policy: policy,
+			want: probe{PeriodSeconds: 10, Timeout: time.Second, FailureThreshold: 5, SuccessThreshold: 1,
+				Type: TCPProbe, Ports: []int32{8080}, MaxUnreachablePercent: 50, Degraded: m.spec.Degraded},
+		},
+		{
+			name:      "annotations over policy",
+			policy:    policy,
+			annotated: true,
+			want: probe{PeriodSeconds: 10, Timeout: 2 * time.Second, FailureThreshold: 7, SuccessThreshold: 1,
+				Type: TCPProbe, Ports: []int32{8080}, MaxUnreachablePercent: 50, Degraded: m.spec.Degraded},
+		},
+		{
+			name:      "annotations over global flags",
+			annotated: true,
+			want: probe{PeriodSeconds: 5, Timeout: 2 * time.Second, FailureThreshold: 7, SuccessThreshold: 1,
+				Type: ICMPProbe, MaxUnreachablePercent: 100, Degraded: m.spec.Degraded},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestServiceImport()
+			if tt.annotated {
+				svc = svcImport
+			}
+			got, err := m.resolveProbe(svc, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("expected probe %+v, got %+v", tt.want, *got)
+			}
+		})
+	}
+}
+
+func TestResolveProbeRejectsInvalidPolicy(t *testing.T) {
+	m, _ := newTestManager()
+	m.spec = ProbeSpec{PeriodSeconds: 5, Timeout: time.Second, FailureThreshold: 3, SuccessThreshold: 1, Type: ICMPProbe,
+		Degraded: DegradedBudget{MaxLossPercent: 100, Threshold: 3, RecoveryThreshold: 1}}
+	timeout := metav1.Duration{Duration: 10 * time.Second}
+	policy := &kosmosv1alpha1.ProbePolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "policy"},
+		Spec:       kosmosv1alpha1.ProbePolicySpec{Timeout: &timeout},
+	}
+	// The timeout of the policy exceeds the global period.
+	if _, err := m.resolveProbe(newTestServiceImport(), policy); err == nil {
+		t.Errorf("expected the timeout exceeding the period to be rejected")
+	}
+
+	policy.Spec = kosmosv1alpha1.ProbePolicySpec{Type: "ping"}
+	if _, err := m.resolveProbe(newTestServiceImport(), policy); err == nil {
+		t.Errorf("expected the unknown probe type to be rejected")
+	}
+	expectEvent(t, m, InvalidProbePolicy)
+}
@@ -0,0 +1,179 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/dump"
+	"k8s.io/klog/v2"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
+)
+
+// target probes an address with a probe configuration once per period and fans the result out to the
+// workers subscribed to it. Workers probing the same address the same way share a target, so an address
+// shared by several serviceImports is probed once per period.
+type target struct {
+	address string
+	// Type, Timeout and PeriodSeconds of the probe.
+	probeType     ProbeType
+	timeout       time.Duration
+	periodSeconds int
+	// Probes the address.
+	prober Prober
+
+	// guards subscribers
+	lock sync.Mutex
+	// workers receiving the results, the target is removed once there are none
+	subscribers map[*worker]struct{}
+}
+
+// matches returns whether the target probes the address with the probe configuration.
+func (t *target) matches(address string, spec *probe, prober Prober) bool {
+	return t.address == address && t.probeType == spec.Type && t.timeout == spec.Timeout &&
+		t.periodSeconds == spec.PeriodSeconds && reflect.DeepEqual(t.prober, prober)
+}
+
+// key identifies the target by the same fields as matches, spreading targets probing the same address
+// differently within their period.
+func (t *target) key() string {
+	h := fnv.New32a()
+	h.Write([]byte(proberConfig(t.prober))) //nolint: errcheck // Writing to a hash never fails.
+	return fmt.Sprintf("%s/%s/%s/%d/%08x", t.address, t.probeType, t.timeout, t.periodSeconds, h.Sum32())
+}
+
+// proberConfig dumps the configuration of the prober, leaving out the state shared by the probers.
+func proberConfig(prober Prober) string {
+	switch p := prober.(type) {
+	case *icmpProber:
+		config := *p
+		config.engine = nil
+		return dump.ForHash(config)
+	case *grpcProber:
+		config := *p
+		config.conns = nil
+		return dump.ForHash(config)
+	default:
+		return dump.ForHash(prober)
+	}
+}
+
+// runOnce probes the address and passes the result to the subscribers, it implements task.
+func (t *target) runOnce() bool {
+	r := t.probe()
+	switch r.Result {
+	case results.Success:
+		klog.V(5).InfoS("Probe success", "address", t.address, "probeType", t.probeType, "latency", r.Latency)
+	case results.Failure:
+		klog.V(3).InfoS("Probe failed", "address", t.address, "probeType", t.probeType, "detail", r.Detail)
+	default:
+		klog.V(3).InfoS("Probe result unknown", "address", t.address, "probeType", t.probeType, "detail", r.Detail)
+	}
+
+	t.lock.Lock()
+	subscribers := make([]*worker, 0, len(t.subscribers))
+	for w := range t.subscribers {
+		subscribers = append(subscribers, w)
+	}
+	t.lock.Unlock()
+
+	now := time.Now()
+	for _, w := range subscribers {
+		w.observe(t, r, now)
+	}
+	return true
+}
+
+// cleanup is called once the last subscriber is gone, it implements task.
+func (t *target) cleanup() {
+	metrics.ProbeTargets.Dec()
+}
+
+// probe probes the address once, turning errors and panics of the prober into an unknown result.
+func (t *target) probe() (r ProbeResult) {
+	defer func() {
+		if p := recover(); p != nil {
+			r = ProbeResult{Result: results.Unknown, Detail: fmt.Sprintf("prober panicked: %v", p)}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		metrics.ProbeDuration.WithLabelValues(string(t.probeType)).Observe(time.Since(start).Seconds())
+	}()
+
+	r, err := t.prober.Probe(ctx, t.address)
+	if err != nil {
+		return ProbeResult{Result: results.Unknown, Detail: err.Error()}
+	}
+	return r
+}
+
+// subscribe subscribes the worker to the target probing the address with the probe configuration,
+// creating and scheduling the target if no worker probes the address that way yet.
+func (m *manager) subscribe(w *worker, address string, spec *probe, prober Prober) *target {
+	m.targetLock.Lock()
+	defer m.targetLock.Unlock()
+
+	var t *target
+	for _, candidate := range m.targets[address] {
+		if candidate.matches(address, spec, prober) {
+			t = candidate
+			break
+		}
+	}
+	if t == nil {
+		t = &target{
+			address:       address,
+			probeType:     spec.Type,
+			timeout:       spec.Timeout,
+			periodSeconds: spec.PeriodSeconds,
+			prober:        prober,
+			subscribers:   map[*worker]struct{}{},
+		}
+		m.targets[address] = append(m.targets[address], t)
+		metrics.ProbeTargets.Inc()
+		m.scheduler.add(t.key(), t, time.Duration(spec.PeriodSeconds)*time.Second)
+	}
+
+	t.lock.Lock()
+	t.subscribers[w] = struct{}{}
+	t.lock.Unlock()
+	return t
+}
+
+// unsubscribe unsubscribes the worker from the target, the target is stopped once it has no subscribers.
+func (m *manager) unsubscribe(w *worker, t *target) {
+	m.targetLock.Lock()
+	defer m.targetLock.Unlock()
+
+	t.lock.Lock()
+	delete(t.subscribers, w)
+	empty := len(t.subscribers) == 0
+	t.lock.Unlock()
+	if !empty {
+		return
+	}
+
+	targets := m.targets[t.address]
+	for i, candidate := range targets {
+		if candidate == t {
+			targets = append(targets[:i], targets[i+1:]...)
+			break
+		}
+	}
+	if len(targets) == 0 {
+		delete(m.targets, t.address)
+	} else {
+		m.targets[t.address] = targets
+	}
+	m.scheduler.remove(t)
+}
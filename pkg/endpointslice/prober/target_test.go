@@ -0,0 +1,121 @@
+package prober
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+// lastOf returns the latest update set for the serviceImport.
+func (f *fakeResults) lastOf(name string) (results.Update, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for i := len(f.updates) - 1; i >= 0; i-- {
+		if f.updates[i].SvcImportName == name {
+			return f.updates[i], true
+		}
+	}
+	return results.Update{}, false
+}
+
+// probeTargets probes every target of the manager once.
+func probeTargets(m *manager) {
+	m.targetLock.Lock()
+	var targets []*target
+	for _, addressTargets := range m.targets {
+		targets = append(targets, addressTargets...)
+	}
+	m.targetLock.Unlock()
+
+	for _, t := range targets {
+		t.runOnce()
+	}
+}
+
+func TestSharedTargetFansOutResults(t *testing.T) {
+	m, resultsManager := newTestManager()
+	prober := newFakeProber()
+	prober.set("10.0.0.2", ProbeResult{Result: results.Failure, Detail: "timeout"})
+	spec := newTestProbe()
+	svcA := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns", UID: "a"}}
+	svcB := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "ns", UID: "b"}}
+
+	a := newWorker(m, []string{"10.0.0.1", "10.0.0.2"}, nil, nil, svcA, spec, prober)
+	a.start()
+	b := newWorker(m, []string{"10.0.0.2"}, nil, nil, svcB, spec, prober)
+	b.start()
+	if len(m.targets["10.0.0.2"]) != 1 || a.targets["10.0.0.2"] != b.targets["10.0.0.2"] {
+		t.Fatalf("expected the serviceImports to share the target of 10.0.0.2, got %v", m.targets["10.0.0.2"])
+	}
+
+	for i := 0; i < spec.FailureThreshold; i++ {
+		probeTargets(m)
+	}
+	if prober.probes["10.0.0.2"] != spec.FailureThreshold {
+		t.Errorf("expected the shared address to be probed once per period, got %d probes", prober.probes["10.0.0.2"])
+	}
+	for _, name := range []string{"a", "b"} {
+		if update, _ := resultsManager.lastOf(name); !reflect.DeepEqual(update.Addresses, []string{"10.0.0.2"}) {
+			t.Errorf("expected 10.0.0.2 to be unreachable for %s, got %v", name, update.Addresses)
+		}
+	}
+
+	// The target is kept as long as a worker is subscribed to it.
+	a.stop()
+	if _, ok := m.targets["10.0.0.1"]; ok {
+		t.Errorf("expected the target of 10.0.0.1 to be removed with its last subscriber")
+	}
+	if len(m.targets["10.0.0.2"]) != 1 {
+		t.Errorf("expected the target of 10.0.0.2 to be kept for b, got %v", m.targets["10.0.0.2"])
+	}
+	b.stop()
+	if len(m.targets) != 0 {
+		t.Errorf("expected all targets to be removed, got %v", m.targets)
+	}
+	m.scheduler.lock.Lock()
+	defer m.scheduler.lock.Unlock()
+	if len(m.scheduler.tasks) != 0 {
+		t.Errorf("expected all targets to be unscheduled, got %d tasks", len(m.scheduler.tasks))
+	}
+}
+
+func TestTargetsProbingDifferentlyAreNotShared(t *testing.T) {
+	m, _ := newTestManager()
+	spec := newTestProbe()
+	longTimeout := newTestProbe()
+	longTimeout.Timeout = 2 * time.Second
+	prober := &tcpProber{ports: []int32{80}, timeout: time.Second}
+	otherPort := &tcpProber{ports: []int32{8080}, timeout: time.Second}
+	svcImport := func(name string) *v1alpha1.ServiceImport {
+		return &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", UID: types.UID(name)}}
+	}
+
+	workers := []*worker{
+		newWorker(m, []string{"10.0.0.1"}, nil, nil, svcImport("a"), spec, prober),
+		// An equal prober is shared.
+		newWorker(m, []string{"10.0.0.1"}, nil, nil, svcImport("b"), spec, &tcpProber{ports: []int32{80}, timeout: time.Second}),
+		newWorker(m, []string{"10.0.0.1"}, nil, nil, svcImport("c"), longTimeout, prober),
+		newWorker(m, []string{"10.0.0.1"}, nil, nil, svcImport("d"), spec, otherPort),
+	}
+	for _, w := range workers {
+		w.start()
+	}
+
+	targets := m.targets["10.0.0.1"]
+	if len(targets) != 3 {
+		t.Fatalf("expected a target per probe configuration, got %d", len(targets))
+	}
+	keys := map[string]bool{}
+	for _, target := range targets {
+		keys[target.key()] = true
+	}
+	if len(keys) != len(targets) {
+		t.Errorf("expected the targets to have distinct keys, got %v", keys)
+	}
+}
@@ -0,0 +1,82 @@
+package prober
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/util"
+)
+
+// TargetSource selects where the probed addresses of a serviceImport come from.
+type TargetSource string
+
+const (
+	// TargetSourceAnnotation probes the addresses of the kosmos.io/address annotation.
+	TargetSourceAnnotation TargetSource = "annotation"
+	// TargetSourceEndpointSlice probes the endpoints of the EndpointSlices of the serviceImport.
+	TargetSourceEndpointSlice TargetSource = "endpointslice"
+)
+
+// ParseTargetSource validates the target source.
+func ParseTargetSource(s string) (TargetSource, error) {
+	switch source := TargetSource(s); source {
+	case TargetSourceAnnotation, TargetSourceEndpointSlice:
+		return source, nil
+	default:
+		return "", fmt.Errorf("unsupported target source %q", s)
+	}
+}
+
+// Targets are the addresses and ports probed for a serviceImport.
+type Targets struct {
+	// Addresses are the probed addresses.
+	Addresses []string
+	// Ports are the ports of the addresses, the TCP ports of the serviceImport are used if empty.
+	// Ports configured by a policy or annotation take precedence.
+	Ports []int32
+	// Invalid are the errors of the entries of the target source which could not be parsed, these
+	// entries are not probed.
+	Invalid []error
+}
+
+// AnnotationTargets returns the addresses of the kosmos.io/address annotation of the serviceImport. Invalid
+// entries are skipped, the others are probed.
+func AnnotationTargets(svcImport *v1alpha1.ServiceImport) *Targets {
+	addrs, errs := util.ConvertStringToAddresses(svcImport.Annotations[ServiceImportEPSAddr])
+	return &Targets{Addresses: addrs, Invalid: errs}
+}
+
+// EndpointSliceTargets returns the IP addresses and TCP ports of the endpoints of the EndpointSlices.
+// Terminating endpoints are skipped, endpoints which are not ready are probed, so they are found
+// reachable again after having been marked not ready.
+func EndpointSliceTargets(slices []discoveryv1.EndpointSlice) *Targets {
+	addrs := sets.New[string]()
+	ports := sets.New[int32]()
+	for _, slice := range slices {
+		if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating {
+				continue
+			}
+			addrs.Insert(endpoint.Addresses...)
+		}
+		for _, port := range slice.Ports {
+			if port.Port == nil || (port.Protocol != nil && *port.Protocol != corev1.ProtocolTCP) {
+				continue
+			}
+			ports.Insert(*port.Port)
+		}
+	}
+
+	targets := &Targets{Addresses: sets.List(addrs)}
+	if ports.Len() > 0 {
+		targets.Ports = sets.List(ports)
+	}
+	return targets
+}
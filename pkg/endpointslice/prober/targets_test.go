@@ -0,0 +1,94 @@
+package prober
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+)
+
+func newTestEndpointSlice(addressType discoveryv1.AddressType, ports []discoveryv1.EndpointPort,
+	endpoints ...discoveryv1.Endpoint) discoveryv1.EndpointSlice {
+	return discoveryv1.EndpointSlice{AddressType: addressType, Ports: ports, Endpoints: endpoints}
+}
+
+func newTestEndpoint(terminating *bool, ready *bool, addrs ...string) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  addrs,
+		Conditions: discoveryv1.EndpointConditions{Ready: ready, Terminating: terminating},
+	}
+}
+
+func TestEndpointSliceTargets(t *testing.T) {
+	yes, no := true, false
+	tcp, udp := corev1.ProtocolTCP, corev1.ProtocolUDP
+	http, dns, grpc := int32(80), int32(53), int32(9090)
+
+	tests := []struct {
+		name      string
+		slices    []discoveryv1.EndpointSlice
+		wantAddrs []string
+		wantPorts []int32
+	}{
+		{
+			name: "no slices",
+		},
+		{
+			name: "addresses deduplicated across slices",
+			slices: []discoveryv1.EndpointSlice{
+				newTestEndpointSlice(discoveryv1.AddressTypeIPv4, nil,
+					newTestEndpoint(nil, nil, "10.0.0.2"), newTestEndpoint(nil, nil, "10.0.0.1")),
+				newTestEndpointSlice(discoveryv1.AddressTypeIPv4, nil, newTestEndpoint(nil, nil, "10.0.0.2", "10.0.0.3")),
+			},
+			wantAddrs: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name: "only TCP ports with a port number",
+			slices: []discoveryv1.EndpointSlice{
+				newTestEndpointSlice(discoveryv1.AddressTypeIPv4, []discoveryv1.EndpointPort{
+					{Protocol: &tcp, Port: &http},
+					{Protocol: &udp, Port: &dns},
+					{Protocol: &tcp},
+				}, newTestEndpoint(nil, nil, "10.0.0.1")),
+				newTestEndpointSlice(discoveryv1.AddressTypeIPv6, []discoveryv1.EndpointPort{
+					{Port: &grpc},
+					{Protocol: &tcp, Port: &http},
+				}, newTestEndpoint(nil, nil, "fd00::1")),
+			},
+			wantAddrs: []string{"10.0.0.1", "fd00::1"},
+			wantPorts: []int32{80, 9090},
+		},
+		{
+			name: "not ready endpoints kept, terminating endpoints skipped",
+			slices: []discoveryv1.EndpointSlice{
+				newTestEndpointSlice(discoveryv1.AddressTypeIPv4, nil,
+					newTestEndpoint(nil, &no, "10.0.0.1"),
+					newTestEndpoint(&yes, &no, "10.0.0.2"),
+					newTestEndpoint(&no, &yes, "10.0.0.3")),
+			},
+			wantAddrs: []string{"10.0.0.1", "10.0.0.3"},
+		},
+		{
+			name: "non IP address types skipped",
+			slices: []discoveryv1.EndpointSlice{
+				newTestEndpointSlice(discoveryv1.AddressTypeFQDN, []discoveryv1.EndpointPort{{Protocol: &tcp, Port: &grpc}},
+					newTestEndpoint(nil, nil, "svc.example.com")),
+				newTestEndpointSlice(discoveryv1.AddressTypeIPv4, nil, newTestEndpoint(nil, nil, "10.0.0.1")),
+			},
+			wantAddrs: []string{"10.0.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := EndpointSliceTargets(tt.slices)
+			if len(targets.Addresses) != len(tt.wantAddrs) ||
+				(len(tt.wantAddrs) > 0 && !reflect.DeepEqual(targets.Addresses, tt.wantAddrs)) {
+				t.Errorf("expected addresses %v, got %v", tt.wantAddrs, targets.Addresses)
+			}
+			if !reflect.DeepEqual(targets.Ports, tt.wantPorts) {
+				t.Errorf("expected ports %v, got %v", tt.wantPorts, targets.Ports)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package prober
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+func init() {
+	MustRegister(TCPProbe, newTCPProber)
+}
+
+// tcpProber dials every TCP port to probe. An address is considered reachable only
+// if all of its ports accept connections.
+type tcpProber struct {
+	ports   []int32
+	timeout time.Duration
+}
+
+func newTCPProber(config *Config) (Prober, error) {
+	if len(config.Ports) == 0 {
+		return nil, fmt.Errorf("no TCP ports found in serviceImport")
+	}
+	return &tcpProber{ports: config.Ports, timeout: config.Timeout}, nil
+}
+
+func (p *tcpProber) Probe(ctx context.Context, address string) (ProbeResult, error) {
+	dialer := &net.Dialer{Timeout: p.timeout}
+	start := time.Now()
+	for _, port := range p.ports {
+		target := net.JoinHostPort(address, strconv.Itoa(int(port)))
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			return ProbeResult{
+				Result: results.Failure,
+				Detail: fmt.Sprintf("connect to port %d failed: %v", port, err),
+			}, nil
+		}
+		if err := conn.Close(); err != nil {
+			klog.V(5).InfoS("Close TCP connection failed", "address", address, "port", port, "err", err)
+		}
+	}
+	return ProbeResult{Result: results.Success, Latency: time.Since(start)}, nil
+}
+
+// filterTCPPorts returns the ports whose protocol is TCP. An empty protocol defaults to TCP.
+func filterTCPPorts(ports []v1alpha1.ServicePort) []int32 {
+	var returned []int32
+	for _, port := range ports {
+		if port.Protocol == "" || port.Protocol == corev1.ProtocolTCP {
+			returned = append(returned, port.Port)
+		}
+	}
+	return returned
+}
@@ -0,0 +1,102 @@
+package prober
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+// listenTCP accepts connections on a local port and returns the port.
+func listenTCP(t *testing.T) int32 {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() }) //nolint: errcheck
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close() //nolint: errcheck
+		}
+	}()
+	return int32(lis.Addr().(*net.TCPAddr).Port)
+}
+
+// closedTCPPort returns a local port nothing listens on.
+func closedTCPPort(t *testing.T) int32 {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := int32(lis.Addr().(*net.TCPAddr).Port)
+	if err := lis.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func TestTCPProbe(t *testing.T) {
+	open, other, closed := listenTCP(t), listenTCP(t), closedTCPPort(t)
+
+	tests := []struct {
+		name  string
+		ports []int32
+		want  results.Result
+	}{
+		{name: "open port", ports: []int32{open}, want: results.Success},
+		{name: "all ports open", ports: []int32{open, other}, want: results.Success},
+		{name: "connection refused", ports: []int32{closed}, want: results.Failure},
+		{name: "one port refused", ports: []int32{open, closed}, want: results.Failure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newTCPProber(&Config{Ports: tt.ports, Timeout: time.Second})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := p.Probe(context.Background(), "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Result != tt.want {
+				t.Errorf("expected %s, got %s (%s)", tt.want, r.Result, r.Detail)
+			}
+			if r.Result == results.Failure && r.Detail == "" {
+				t.Errorf("expected the failed port to be reported")
+			}
+		})
+	}
+}
+
+func TestNewTCPProberRequiresPorts(t *testing.T) {
+	if _, err := newTCPProber(&Config{Timeout: time.Second}); err == nil {
+		t.Errorf("expected an error without ports")
+	}
+}
+
+func TestFilterTCPPorts(t *testing.T) {
+	ports := []v1alpha1.ServicePort{
+		{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80},
+		{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 53},
+		{Name: "default", Port: 8080},
+		{Name: "sctp", Protocol: corev1.ProtocolSCTP, Port: 9000},
+	}
+	if got, want := filterTCPPorts(ports), []int32{80, 8080}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected ports %v, got %v", want, got)
+	}
+	if got := filterTCPPorts([]v1alpha1.ServicePort{{Protocol: corev1.ProtocolUDP, Port: 53}}); len(got) != 0 {
+		t.Errorf("expected no TCP ports, got %v", got)
+	}
+}
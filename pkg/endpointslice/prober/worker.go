@@ -1,26 +1,31 @@
 package prober
 
 import (
-	"math/rand"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
 	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
 )
 
+// worker tracks the reachability of the addresses of a serviceImport. It subscribes to a target for every
+// address and publishes the results it receives from them.
 type worker struct {
-	// Channel for stopping the probe.
-	stopCh chan struct{}
+	// Guards the state of the worker, results and updates are never handled at the same time.
+	lock sync.Mutex
 
-	// Channel for triggering the probe manually.
-	manualTriggerCh chan struct{}
-
-	// Channel for updating the endpointslice addresses.
-	UpdateCh chan []string
+	// Set once the worker is stopped, results received afterwards are dropped.
+	stopped bool
 
 	// Addresses to check the connectivity.
 	addresses []string
@@ -35,132 +40,409 @@ type worker struct {
 	// Describe the probe configuration.
 	spec *probe
 
+	// Probes a single address.
+	prober Prober
+
+	// The targets the worker is subscribed to, by address.
+	targets map[string]*target
+
 	// Records the addresses probe results.
-	records      map[string]record
-	latestResult results.Result
+	records map[string]record
+
+	// The sorted unreachable addresses last published to the results manager.
+	published []string
+
+	// The sorted degraded addresses last published to the results manager.
+	publishedDegraded []string
+
+	// When the address statuses were last published.
+	statusPublished time.Time
+
+	// The error of the invalid probe configuration the worker has been updated with, recorded as an event
+	// once. The worker keeps probing with its current configuration meanwhile.
+	invalidProbe string
 }
 
 type probe struct {
 	PeriodSeconds    int
+	Timeout          time.Duration
 	FailureThreshold int
+	SuccessThreshold int
+	Type             ProbeType
+	// Ports overrides the TCP ports of the ServiceImport to probe.
+	Ports []int32
+	// MaxUnreachablePercent is the maximum percentage of addresses that may be published as unreachable.
+	MaxUnreachablePercent int
+	// Degraded is the latency and loss budget of the addresses which respond to the probe.
+	Degraded DegradedBudget
+}
+
+type workerUpdate struct {
+	addresses     []string
+	serviceImport *v1alpha1.ServiceImport
+	spec          *probe
+	prober        Prober
+	// invalidProbe is the error of an invalid probe configuration, the spec and prober are unset then.
+	invalidProbe error
 }
 
 type record struct {
 	lastResult results.Result
-	resultRun  int
+	// successRun counts the consecutive successful or degraded probes, failureRun the consecutive failed ones.
+	successRun int
+	failureRun int
+	// degradedRun counts the consecutive degraded probes, healthyRun the consecutive successful ones.
+	degradedRun int
+	healthyRun  int
+	// reason describes why the last probe did not succeed or was degraded.
+	reason string
+	// unreachable is set once FailureThreshold consecutive failures are reached, and cleared
+	// once SuccessThreshold consecutive successes are reached.
+	unreachable bool
+	// lastTransitionTime is when unreachable last changed.
+	lastTransitionTime time.Time
+	// degraded is set once Degraded.Threshold consecutive degraded probes are reached, and cleared
+	// once Degraded.RecoveryThreshold consecutive successful probes are reached.
+	degraded bool
+	// lastDegradedTransitionTime is when degraded last changed.
+	lastDegradedTransitionTime time.Time
+	// lastProbeTime is when the address was last probed.
+	lastProbeTime time.Time
+	// lastRTT is the latency of the last successful or degraded probe.
+	lastRTT time.Duration
+	// lastPackets are the packet statistics of the last probe, if it sends packets.
+	lastPackets *PacketStats
 }
 
-func newWorker(m *manager, addrs []string, unReachableAddrs []string, svcImport *v1alpha1.ServiceImport) *worker {
-	lastResult := results.Success
-	if len(unReachableAddrs) > 0 {
-		lastResult = results.Failure
+func newWorker(m *manager, addrs []string, unReachableAddrs []string, degradedAddrs []string,
+	svcImport *v1alpha1.ServiceImport, spec *probe, prober Prober) *worker {
+	// Addresses already published as unreachable stay so until they pass the success threshold, and
+	// addresses already published as degraded until they pass the degraded recovery threshold.
+	records := map[string]record{}
+	for _, addr := range degradedAddrs {
+		records[addr] = record{lastResult: results.Degraded, degraded: true}
 	}
+	for _, addr := range unReachableAddrs {
+		records[addr] = record{lastResult: results.Failure, unreachable: true}
+	}
+	pruneRecords(records, addrs)
+
+	published := append([]string{}, unReachableAddrs...)
+	sort.Strings(published)
+	publishedDegraded := append([]string{}, degradedAddrs...)
+	sort.Strings(publishedDegraded)
 	w := &worker{
-		stopCh:          make(chan struct{}, 1),
-		manualTriggerCh: make(chan struct{}, 1),
-		UpdateCh:        make(chan []string, 1),
-		serviceImport:   svcImport,
-		addresses:       addrs,
-		probeManager:    m,
-		resultsManager:  m.resultsManager,
-		spec: &probe{
-			PeriodSeconds:    m.spec.PeriodSeconds,
-			FailureThreshold: m.spec.FailureThreshold,
-		},
-		records:      map[string]record{},
-		latestResult: lastResult,
+		serviceImport:     svcImport,
+		addresses:         addrs,
+		probeManager:      m,
+		resultsManager:    m.resultsManager,
+		spec:              spec,
+		prober:            prober,
+		targets:           map[string]*target{},
+		records:           records,
+		published:         published,
+		publishedDegraded: publishedDegraded,
 	}
 	return w
 }
 
-func (w *worker) run() {
-	probeTickerPeriod := time.Duration(w.spec.PeriodSeconds) * time.Second
+// key identifies the worker, it is the namespaced name of its serviceImport.
+func (w *worker) key() string {
+	return w.serviceImport.Namespace + string(types.Separator) + w.serviceImport.Name
+}
+
+// start subscribes the worker to the targets of its addresses. Addresses published as unreachable or
+// degraded which are no longer probed are cleared right away, since no result will ever arrive for them.
+func (w *worker) start() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.subscribe()
+	w.publish(time.Now(), false)
+}
+
+// subscribe subscribes to the targets of the addresses the worker is not subscribed to yet.
+func (w *worker) subscribe() {
+	for _, addr := range w.addresses {
+		if _, ok := w.targets[addr]; !ok {
+			w.targets[addr] = w.probeManager.subscribe(w, addr, w.spec, w.prober)
+		}
+	}
+}
 
-	if probeTickerPeriod > time.Since(w.probeManager.start) {
-		time.Sleep(time.Duration(rand.Float64() * float64(probeTickerPeriod))) //nolint: gosec
+// unsubscribe unsubscribes from the targets of the addresses which are no longer probed by the worker.
+// All targets are unsubscribed if all is set.
+func (w *worker) unsubscribe(all bool) {
+	for addr, t := range w.targets {
+		if all || !containsString(addr, w.addresses) {
+			w.probeManager.unsubscribe(w, t)
+			delete(w.targets, addr)
+		}
 	}
+}
 
-	probeTicker := time.NewTicker(probeTickerPeriod)
-	defer func() {
-		probeTicker.Stop()
-		namespaceName := w.serviceImport.Namespace + string(types.Separator) + w.serviceImport.Name
-		w.probeManager.removeWorker(namespaceName)
-	}()
+// update applies the update if it changes the addresses or the probe configuration of the worker.
+func (w *worker) update(update workerUpdate) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
 
-probeLoop:
-	for {
-		select {
-		case <-w.stopCh:
-			klog.V(3).InfoS("Stopping prober worker", "serviceImport", klog.KObj(w.serviceImport))
-			break probeLoop
-		case <-probeTicker.C:
-			w.doProbe()
-		case <-w.manualTriggerCh:
-		case updates := <-w.UpdateCh:
-			w.addresses = updates
+	if update.invalidProbe != nil {
+		if invalid := update.invalidProbe.Error(); invalid != w.invalidProbe {
+			w.probeManager.recorder.Eventf(update.serviceImport, corev1.EventTypeWarning, InvalidProbe,
+				"Probing with the previous probe configuration, the probe configuration is invalid: %s", invalid)
+			w.invalidProbe = invalid
 		}
+		update.spec, update.prober = w.spec, w.prober
+	} else {
+		w.invalidProbe = ""
+	}
+
+	current := append([]string{}, w.addresses...)
+	sort.Strings(current)
+	if reflect.DeepEqual(current, update.addresses) && reflect.DeepEqual(w.spec, update.spec) &&
+		reflect.DeepEqual(w.prober, update.prober) {
+		return
+	}
+
+	// A changed probe configuration moves the worker to other targets.
+	probeChanged := w.spec.Type != update.spec.Type || w.spec.Timeout != update.spec.Timeout ||
+		w.spec.PeriodSeconds != update.spec.PeriodSeconds || !reflect.DeepEqual(w.prober, update.prober)
+
+	w.addresses = update.addresses
+	removed := pruneRecords(w.records, w.addresses)
+	for _, addr := range removed {
+		metrics.DeleteAddress(w.serviceImport.Namespace, w.serviceImport.Name, addr)
 	}
+	w.serviceImport = update.serviceImport
+	w.spec = update.spec
+	w.prober = update.prober
+
+	w.unsubscribe(probeChanged)
+	w.subscribe()
+	// No result arrives for removed addresses anymore, publish without them right away.
+	w.publish(time.Now(), len(removed) > 0)
+	klog.V(3).InfoS("Updated prober worker", "serviceImport", klog.KObj(w.serviceImport), "spec", w.spec)
 }
 
+// stop unsubscribes the worker from all targets and unregisters it.
 func (w *worker) stop() {
-	select {
-	case w.stopCh <- struct{}{}:
-	default: // Non-blocking.
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.stopped {
+		return
 	}
+	klog.V(3).InfoS("Stopping prober worker", "serviceImport", klog.KObj(w.serviceImport))
+	w.stopped = true
+	w.unsubscribe(true)
+	w.probeManager.removeWorker(w)
+	w.resultsManager.Remove(w.serviceImport.UID)
+	metrics.DeleteServiceImport(w.serviceImport.Namespace, w.serviceImport.Name)
 }
 
-// doProbe probes the endpointSlice once and records the result.
-// Returns whether the worker should continue.
-func (w *worker) doProbe() (keepGoing bool) {
+// observe records the probe result of a target and publishes the unreachable and degraded addresses.
+func (w *worker) observe(t *target, r ProbeResult, now time.Time) {
 	defer func() { recover() }() //nolint: errcheck // Actually eat panics (HandleCrash takes care of logging)
-	defer runtime.HandleCrash(func(_ interface{}) { keepGoing = true })
-
-	if w.serviceImport.DeletionTimestamp != nil {
-		klog.V(3).InfoS("ServiceImport deletion requested, setting probe result to success",
-			"serviceImport", klog.KObj(w.serviceImport))
+	defer runtime.HandleCrash()
 
-		w.resultsManager.Set(w.serviceImport, w.addresses, results.Success)
-		return false
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	// Drop results of targets the worker has unsubscribed from meanwhile.
+	if w.stopped || w.targets[t.address] != t {
+		return
 	}
 
-	result, err := runProber(w.addresses)
-	if err != nil {
-		return true
+	changed := w.recordResult(t.address, r, now)
+	// Refresh the address statuses periodically, if enabled.
+	period := w.probeManager.spec.StatusReportPeriod
+	w.publish(now, changed || (period > 0 && now.Sub(w.statusPublished) >= period))
+}
+
+// publish publishes the unreachable and degraded addresses to the results manager if either set differs
+// from the published one, or if force is set.
+func (w *worker) publish(now time.Time, force bool) {
+	addrs, degradedAddrs := []string{}, []string{}
+	for addr, r := range w.records {
+		switch {
+		case r.unreachable:
+			addrs = append(addrs, addr)
+		case r.degraded:
+			degradedAddrs = append(degradedAddrs, addr)
+		}
 	}
+	sort.Strings(addrs)
+	sort.Strings(degradedAddrs)
 
-	// Store the probe results into w.records
-	for address, r := range result {
-		if w.records[address].lastResult == r {
-			w.records[address] = record{
-				resultRun:  w.records[address].resultRun + 1,
-				lastResult: r,
-			}
-		} else {
-			w.records[address] = record{
-				resultRun:  1,
-				lastResult: r,
+	// Losing that many addresses at once more likely points to a problem of the prober itself, only the
+	// addresses already published as unreachable stay so. Degraded addresses and statuses are still published.
+	suppressed := len(addrs)*100 > w.spec.MaxUnreachablePercent*len(w.addresses)
+	if suppressed {
+		kept := []string{}
+		for _, addr := range w.published {
+			if w.records[addr].unreachable {
+				kept = append(kept, addr)
 			}
 		}
+		addrs = kept
 	}
 
-	// Check if the number of failures has been reached.
-	var addrs []string
-	for addr, r := range w.records {
-		if r.lastResult == results.Failure && r.resultRun >= w.spec.FailureThreshold {
-			addrs = append(addrs, addr)
+	if !reflect.DeepEqual(addrs, w.published) || !reflect.DeepEqual(degradedAddrs, w.publishedDegraded) || force {
+		result := results.Success
+		switch {
+		case len(addrs) != 0:
+			result = results.Failure
+		case len(degradedAddrs) != 0:
+			result = results.Degraded
+		}
+		if suppressed {
+			klog.InfoS("Too many unreachable addresses, keeping the published unreachable addresses",
+				"serviceImport", klog.KObj(w.serviceImport), "not reachable addresses", addrs,
+				"maxUnreachablePercent", w.spec.MaxUnreachablePercent)
+		}
+		w.resultsManager.Set(w.serviceImport, addrs, degradedAddrs, result, w.addressStatuses(addrs))
+		klog.V(3).InfoS("Set probe results", "serviceImport", klog.KObj(w.serviceImport), "result", result,
+			"not reachable addresses", addrs, "previous not reachable addresses", w.published,
+			"degraded addresses", degradedAddrs, "previous degraded addresses", w.publishedDegraded)
+		w.published = addrs
+		w.publishedDegraded = degradedAddrs
+		w.statusPublished = now
+	}
+}
+
+// recordResult stores the probe result of the address into w.records. It returns whether the result
+// or the reachability or degraded state of the address has changed.
+func (w *worker) recordResult(address string, r ProbeResult, now time.Time) bool {
+	// A successful probe exceeding the degraded budget is degraded.
+	if r.Result == results.Success {
+		if exceeded, detail := w.spec.Degraded.exceeded(r); exceeded {
+			r.Result = results.Degraded
+			r.Detail = detail
 		}
 	}
 
-	if len(addrs) == 0 && w.latestResult == results.Failure {
-		w.resultsManager.Set(w.serviceImport, []string{}, results.Success)
-		w.latestResult = results.Success
-		klog.V(3).InfoS("Set probe results to success", "serviceImport", klog.KObj(w.serviceImport))
+	rec, found := w.records[address]
+	changed := !found || rec.lastResult != r.Result
+	rec.lastResult = r.Result
+	switch r.Result {
+	case results.Success, results.Degraded:
+		rec.successRun++
+		rec.failureRun = 0
+	case results.Failure:
+		rec.failureRun++
+		rec.successRun = 0
+	default:
+		rec.successRun, rec.failureRun = 0, 0
+	}
+	switch r.Result {
+	case results.Degraded:
+		rec.degradedRun++
+		rec.healthyRun = 0
+	case results.Success:
+		rec.healthyRun++
+		rec.degradedRun = 0
+	default:
+		// Probes without a response tell nothing about the latency of the address.
+		rec.degradedRun, rec.healthyRun = 0, 0
+	}
+	rec.reason = r.Detail
+	rec.lastProbeTime = now
+	if r.Result == results.Success || r.Result == results.Degraded {
+		rec.lastRTT = r.Latency
+	}
+	rec.lastPackets = r.Packets
+
+	// Check if the number of failures or successes has been reached.
+	if rec.failureRun >= w.spec.FailureThreshold && !rec.unreachable {
+		rec.unreachable = true
+		changed = true
+		rec.lastTransitionTime = now
+		w.probeManager.recorder.Eventf(w.serviceImport, corev1.EventTypeWarning, EndpointUnreachable,
+			"Address %s is unreachable after %d consecutive failed %s probes: %s", address, rec.failureRun, w.spec.Type, rec.reason)
+	}
+	if rec.successRun >= w.spec.SuccessThreshold && rec.unreachable {
+		rec.unreachable = false
+		changed = true
+		rec.lastTransitionTime = now
+		w.probeManager.recorder.Eventf(w.serviceImport, corev1.EventTypeNormal, EndpointRecovered,
+			"Address %s is reachable again after %d consecutive successful %s probes, latency %s",
+			address, rec.successRun, w.spec.Type, r.Latency)
+	}
+
+	// Check if the number of degraded or successful probes within the budget has been reached.
+	if rec.degradedRun >= w.spec.Degraded.Threshold && !rec.degraded {
+		rec.degraded = true
+		changed = true
+		rec.lastDegradedTransitionTime = now
+		w.probeManager.recorder.Eventf(w.serviceImport, corev1.EventTypeWarning, EndpointDegraded,
+			"Address %s is degraded after %d consecutive %s probes exceeding the budget: %s",
+			address, rec.degradedRun, w.spec.Type, rec.reason)
 	}
-	if len(addrs) != 0 && w.latestResult == results.Success {
-		w.resultsManager.Set(w.serviceImport, addrs, results.Failure)
-		w.latestResult = results.Failure
-		klog.V(3).InfoS("Set probe results to failure", "serviceImport", klog.KObj(w.serviceImport), "not reachable addresses", addrs)
+	if rec.healthyRun >= w.spec.Degraded.RecoveryThreshold && rec.degraded {
+		rec.degraded = false
+		changed = true
+		rec.lastDegradedTransitionTime = now
+		w.probeManager.recorder.Eventf(w.serviceImport, corev1.EventTypeNormal, EndpointWithinBudget,
+			"Address %s is within the budget again after %d consecutive successful %s probes, latency %s",
+			address, rec.healthyRun, w.spec.Type, r.Latency)
 	}
+	w.records[address] = rec
 
-	return true
+	metrics.ProbeResults.WithLabelValues(w.serviceImport.Namespace, w.serviceImport.Name, address, r.Result.String()).Inc()
+	metrics.ProbeConsecutiveFailures.WithLabelValues(w.serviceImport.Namespace, w.serviceImport.Name, address).
+		Set(float64(rec.failureRun))
+	if r.Packets != nil {
+		metrics.ProbePacketLoss.WithLabelValues(w.serviceImport.Namespace, w.serviceImport.Name, address).
+			Set(r.Packets.LossPercent / 100)
+		if r.Packets.Received > 0 {
+			metrics.ProbeRTT.WithLabelValues(w.serviceImport.Namespace, w.serviceImport.Name, address).
+				Set(r.Packets.AvgRTT.Seconds())
+		}
+	}
+
+	return changed
+}
+
+// addressStatuses converts w.records into the published address statuses.
+func (w *worker) addressStatuses(published []string) []results.AddressStatus {
+	statuses := make([]results.AddressStatus, 0, len(w.records))
+	for addr, rec := range w.records {
+		status := results.AddressStatus{
+			Address:              addr,
+			Reachable:            !rec.unreachable,
+			Suppressed:           rec.unreachable && !containsString(addr, published),
+			Degraded:             rec.degraded && !rec.unreachable,
+			LastResult:           rec.lastResult.String(),
+			ConsecutiveSuccesses: rec.successRun,
+			ConsecutiveFailures:  rec.failureRun,
+			Reason:               rec.reason,
+		}
+		if !rec.lastTransitionTime.IsZero() {
+			status.LastTransitionTime = &metav1.Time{Time: rec.lastTransitionTime}
+		}
+		if !rec.lastDegradedTransitionTime.IsZero() {
+			status.LastDegradedTransitionTime = &metav1.Time{Time: rec.lastDegradedTransitionTime}
+		}
+		if !rec.lastProbeTime.IsZero() {
+			status.LastProbeTime = &metav1.Time{Time: rec.lastProbeTime}
+		}
+		if rec.lastRTT > 0 {
+			status.LastRTT = &metav1.Duration{Duration: rec.lastRTT}
+		}
+		if rec.lastPackets != nil {
+			loss := int(math.Round(rec.lastPackets.LossPercent))
+			status.PacketLossPercent = &loss
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// pruneRecords removes the records of addresses which are no longer probed and returns these addresses.
+func pruneRecords(records map[string]record, addrs []string) []string {
+	var removed []string
+	for addr := range records {
+		if !containsString(addr, addrs) {
+			delete(records, addr)
+			removed = append(removed, addr)
+		}
+	}
+	return removed
 }
@@ -0,0 +1,512 @@
+package prober
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	eventrecord "k8s.io/client-go/tools/record"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+)
+
+// fakeProber returns the result set for an address, success if none is set, and counts the probes.
+type fakeProber struct {
+	lock    sync.Mutex
+	results map[string]ProbeResult
+	probes  map[string]int
+}
+
+func newFakeProber() *fakeProber {
+	return &fakeProber{results: map[string]ProbeResult{}, probes: map[string]int{}}
+}
+
+func (p *fakeProber) set(address string, r ProbeResult) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.results[address] = r
+}
+
+func (p *fakeProber) Probe(_ context.Context, address string) (ProbeResult, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.probes[address]++
+	if r, ok := p.results[address]; ok {
+		return r, nil
+	}
+	return ProbeResult{Result: results.Success, Latency: time.Millisecond}, nil
+}
+
+// fakeResults records the results set by the workers.
+type fakeResults struct {
+	lock    sync.Mutex
+	updates []results.Update
+	removed []types.UID
+}
+
+func (f *fakeResults) Get(types.UID) (results.Result, bool) { return results.Unknown, false }
+
+func (f *fakeResults) Set(svcImport *v1alpha1.ServiceImport, addrs, degraded []string, result results.Result,
+	statuses []results.AddressStatus) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.updates = append(f.updates, results.Update{
+		Addresses:         addrs,
+		DegradedAddresses: degraded,
+		Result:            result,
+		SvcImportName:     svcImport.Name,
+		Namespace:         svcImport.Namespace,
+		Statuses:          statuses,
+	})
+}
+
+func (f *fakeResults) Remove(uid types.UID) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.removed = append(f.removed, uid)
+}
+
+func (f *fakeResults) Pop() (results.Update, bool) { return results.Update{}, false }
+
+func (f *fakeResults) ShutDown() {}
+
+// last returns the latest update and the number of updates set so far.
+func (f *fakeResults) last() (results.Update, int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.updates) == 0 {
+		return results.Update{}, 0
+	}
+	return f.updates[len(f.updates)-1], len(f.updates)
+}
+
+// newTestManager returns a manager whose scheduler is never run, targets are probed by probeAll instead.
+func newTestManager() (*manager, *fakeResults) {
+	resultsManager := &fakeResults{}
+	return &manager{
+		recorder:       eventrecord.NewFakeRecorder(100),
+		workers:        make(map[probeKey]*worker),
+		targets:        make(map[string][]*target),
+		scheduler:      newScheduler(1),
+		resultsManager: resultsManager,
+	}, resultsManager
+}
+
+func newTestServiceImport() *v1alpha1.ServiceImport {
+	return &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns", UID: "uid"}}
+}
+
+func newTestProbe() *probe {
+	return &probe{
+		PeriodSeconds:         5,
+		Timeout:               time.Second,
+		FailureThreshold:      3,
+		SuccessThreshold:      2,
+		Type:                  ICMPProbe,
+		MaxUnreachablePercent: 100,
+		Degraded:              DegradedBudget{MaxLossPercent: 100, Threshold: 2, RecoveryThreshold: 2},
+	}
+}
+
+// probeAll probes every address of the worker once.
+func probeAll(w *worker) {
+	w.lock.Lock()
+	targets := make([]*target, 0, len(w.targets))
+	for _, t := range w.targets {
+		targets = append(targets, t)
+	}
+	w.lock.Unlock()
+
+	for _, t := range targets {
+		t.runOnce()
+	}
+}
+
+func TestWorkerClearsRemovedUnreachableAddress(t *testing.T) {
+	m, resultsManager := newTestManager()
+	prober := newFakeProber()
+	prober.set("10.0.0.2", ProbeResult{Result: results.Failure, Detail: "timeout"})
+	spec := newTestProbe()
+	svcImport := newTestServiceImport()
+
+	w := newWorker(m, []string{"10.0.0.1", "10.0.0.2"}, nil, nil, svcImport, spec, prober)
+	w.start()
+	for i := 0; i < spec.FailureThreshold; i++ {
+		probeAll(w)
+	}
+	if update, _ := resultsManager.last(); !reflect.DeepEqual(update.Addresses, []string{"10.0.0.2"}) {
+		t.Fatalf("expected 10.0.0.2 to be unreachable, got %v", update.Addresses)
+	}
+
+	// The failing address is removed, no result arrives for it anymore.
+	w.update(workerUpdate{addresses: []string{"10.0.0.1"}, serviceImport: svcImport, spec: spec, prober: prober})
+	update, _ := resultsManager.last()
+	if len(update.Addresses) != 0 || update.Result != results.Success {
+		t.Errorf("expected no unreachable address after removing it, got %v (%s)", update.Addresses, update.Result)
+	}
+	if len(update.Statuses) != 1 || update.Statuses[0].Address != "10.0.0.1" {
+		t.Errorf("expected the status of 10.0.0.1 only, got %+v", update.Statuses)
+	}
+}
+
+func TestWorkerClearsPublishedAddressesWithoutTargets(t *testing.T) {
+	m, resultsManager := newTestManager()
+	svcImport := newTestServiceImport()
+
+	// The addresses were published by a previous run, the serviceImport has no address left meanwhile.
+	w := newWorker(m, nil, []string{"10.0.0.2"}, []string{"10.0.0.3"}, svcImport, newTestProbe(), newFakeProber())
+	w.start()
+
+	update, n := resultsManager.last()
+	if n != 1 {
+		t.Fatalf("expected the cleared addresses to be published once, got %d updates", n)
+	}
+	if len(update.Addresses) != 0 || len(update.DegradedAddresses) != 0 {
+		t.Errorf("expected no unreachable or degraded address, got %v and %v", update.Addresses, update.DegradedAddresses)
+	}
+}
+
+func TestWorkerDoesNotPublishUnchangedStart(t *testing.T) {
+	m, resultsManager := newTestManager()
+	w := newWorker(m, []string{"10.0.0.1"}, []string{"10.0.0.1"}, nil, newTestServiceImport(), newTestProbe(), newFakeProber())
+	w.start()
+
+	if _, n := resultsManager.last(); n != 0 {
+		t.Errorf("expected nothing to be published before the first probe, got %d updates", n)
+	}
+}
+
+// events drains the events recorded so far.
+func events(m *manager) []string {
+	recorder := m.recorder.(*eventrecord.FakeRecorder)
+	var got []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			got = append(got, e)
+		default:
+			return got
+		}
+	}
+}
+
+// expectEvent checks that exactly one event was recorded since the last call, and that it has the reason.
+func expectEvent(t *testing.T, m *manager, reason string) {
+	t.Helper()
+	got := events(m)
+	if len(got) != 1 || !strings.Contains(got[0], " "+reason+" ") {
+		t.Errorf("expected one %s event, got %v", reason, got)
+	}
+}
+
+func expectNoEvent(t *testing.T, m *manager) {
+	t.Helper()
+	if got := events(m); len(got) != 0 {
+		t.Errorf("expected no event, got %v", got)
+	}
+}
+
+func TestWorkerFailureAndSuccessThresholds(t *testing.T) {
+	m, resultsManager := newTestManager()
+	prober := newFakeProber()
+	spec := newTestProbe()
+	w := newWorker(m, []string{"10.0.0.1", "10.0.0.2"}, nil, nil, newTestServiceImport(), spec, prober)
+	w.start()
+
+	prober.set("10.0.0.2", ProbeResult{Result: results.Failure, Detail: "timeout"})
+	for i := 1; i < spec.FailureThreshold; i++ {
+		probeAll(w)
+		if update, _ := resultsManager.last(); len(update.Addresses) != 0 {
+			t.Fatalf("expected no unreachable address after %d failures, got %v", i, update.Addresses)
+		}
+	}
+	expectNoEvent(t, m)
+
+	probeAll(w)
+	update, _ := resultsManager.last()
+	if !reflect.DeepEqual(update.Addresses, []string{"10.0.0.2"}) || update.Result != results.Failure {
+		t.Fatalf("expected 10.0.0.2 to be unreachable after %d failures, got %v (%s)",
+			spec.FailureThreshold, update.Addresses, update.Result)
+	}
+	expectEvent(t, m, EndpointUnreachable)
+
+	// Further failures don't publish nor record anything new.
+	_, n := resultsManager.last()
+	probeAll(w)
+	if _, after := resultsManager.last(); after != n {
+		t.Errorf("expected no update for an unchanged result, got %d more", after-n)
+	}
+	expectNoEvent(t, m)
+
+	prober.set("10.0.0.2", ProbeResult{Result: results.Success, Latency: time.Millisecond})
+	for i := 1; i < spec.SuccessThreshold; i++ {
+		probeAll(w)
+		if update, _ := resultsManager.last(); !reflect.DeepEqual(update.Addresses, []string{"10.0.0.2"}) {
+			t.Fatalf("expected 10.0.0.2 to stay unreachable after %d successes, got %v", i, update.Addresses)
+		}
+	}
+	expectNoEvent(t, m)
+
+	probeAll(w)
+	update, _ = resultsManager.last()
+	if len(update.Addresses) != 0 || update.Result != results.Success {
+		t.Errorf("expected 10.0.0.2 to be reachable after %d successes, got %v (%s)",
+			spec.SuccessThreshold, update.Addresses, update.Result)
+	}
+	expectEvent(t, m, EndpointRecovered)
+}
+
+func TestWorkerUnknownResultResetsRuns(t *testing.T) {
+	m, resultsManager := newTestManager()
+	prober := newFakeProber()
+	spec := newTestProbe()
+	w := newWorker(m, []string{"10.0.0.1"}, nil, nil, newTestServiceImport(), spec, prober)
+	w.start()
+
+	failure := ProbeResult{Result: results.Failure, Detail: "timeout"}
+	sequence := []ProbeResult{failure, failure, {Result: results.Unknown, Detail: "probe error"}, failure, failure}
+	for _, r := range sequence {
+		prober.set("10.0.0.1", r)
+		probeAll(w)
+	}
+	if update, _ := resultsManager.last(); len(update.Addresses) != 0 {
+		t.Fatalf("expected an unknown result to interrupt the failures, got %v", update.Addresses)
+	}
+
+	prober.set("10.0.0.1", failure)
+	probeAll(w)
+	if update, _ := resultsManager.last(); !reflect.DeepEqual(update.Addresses, []string{"10.0.0.1"}) {
+		t.Errorf("expected 10.0.0.1 to be unreachable after %d failures in a row, got %v",
+			spec.FailureThreshold, update.Addresses)
+	}
+}
+
+func TestWorkerKeepsPublishedUnreachableAddresses(t *testing.T) {
+	m, resultsManager := newTestManager()
+	spec := newTestProbe()
+	w := newWorker(m, []string{"10.0.0.1"}, []string{"10.0.0.1"}, nil, newTestServiceImport(), spec, newFakeProber())
+	w.start()
+
+	// An address published as unreachable by a previous run stays so until it reaches the success threshold.
+	for i := 1; i < spec.SuccessThreshold; i++ {
+		probeAll(w)
+		if update, n := resultsManager.last(); n != 0 && !reflect.DeepEqual(update.Addresses, []string{"10.0.0.1"}) {
+			t.Fatalf("expected 10.0.0.1 to stay unreachable after %d successes, got %v", i, update.Addresses)
+		}
+	}
+	probeAll(w)
+	if update, n := resultsManager.last(); n == 0 || len(update.Addresses) != 0 {
+		t.Errorf("expected 10.0.0.1 to be reachable after %d successes, got %v", spec.SuccessThreshold, update.Addresses)
+	}
+}
+
+func TestWorkerPublishesEveryChangeOfUnreachableAddresses(t *testing.T) {
+	m, resultsManager := newTestManager()
+	prober := newFakeProber()
+	spec := newTestProbe()
+	spec.FailureThreshold = 1
+	w := newWorker(m, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, nil, nil, newTestServiceImport(), spec, prober)
+	w.start()
+
+	failure := ProbeResult{Result: results.Failure, Detail: "timeout"}
+	prober.set("10.0.0.2", failure)
+	probeAll(w)
+	prober.set("10.0.0.1", failure)
+	probeAll(w)
+
+	// Every probed address publishes its status, the unreachable addresses change twice.
+	resultsManager.lock.Lock()
+	defer resultsManager.lock.Unlock()
+	var changes [][]string
+	for _, update := range resultsManager.updates {
+		if len(update.Addresses) == 0 {
+			continue
+		}
+		if len(changes) == 0 || !reflect.DeepEqual(changes[len(changes)-1], update.Addresses) {
+			changes = append(changes, update.Addresses)
+		}
+	}
+	want := [][]string{{"10.0.0.2"}, {"10.0.0.1", "10.0.0.2"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("expected the unreachable addresses to change to %v, got %v", want, changes)
+	}
+}
+
+func TestWorkerDegradedThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   DegradedBudget
+		exceeded ProbeResult
+	}{
+		{
+			name:     "latency",
+			budget:   DegradedBudget{MaxLatency: 100 * time.Millisecond, MaxLossPercent: 100, Threshold: 2, RecoveryThreshold: 3},
+			exceeded: ProbeResult{Result: results.Success, Latency: 200 * time.Millisecond},
+		},
+		{
+			name:   "packet loss",
+			budget: DegradedBudget{MaxLossPercent: 20, Threshold: 2, RecoveryThreshold: 3},
+			exceeded: ProbeResult{Result: results.Success, Latency: time.Millisecond,
+				Packets: &PacketStats{Sent: 4, Received: 2, LossPercent: 50, AvgRTT: time.Millisecond}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, resultsManager := newTestManager()
+			prober := newFakeProber()
+			spec := newTestProbe()
+			spec.Degraded = tt.budget
+			w := newWorker(m, []string{"10.0.0.1"}, nil, nil, newTestServiceImport(), spec, prober)
+			w.start()
+
+			prober.set("10.0.0.1", tt.exceeded)
+			for i := 1; i < tt.budget.Threshold; i++ {
+				probeAll(w)
+				if update, _ := resultsManager.last(); len(update.DegradedAddresses) != 0 {
+					t.Fatalf("expected no degraded address after %d probes, got %v", i, update.DegradedAddresses)
+				}
+			}
+			expectNoEvent(t, m)
+
+			probeAll(w)
+			update, _ := resultsManager.last()
+			if !reflect.DeepEqual(update.DegradedAddresses, []string{"10.0.0.1"}) || update.Result != results.Degraded {
+				t.Fatalf("expected 10.0.0.1 to be degraded after %d probes, got %v (%s)",
+					tt.budget.Threshold, update.DegradedAddresses, update.Result)
+			}
+			if len(update.Addresses) != 0 {
+				t.Errorf("expected a degraded address to stay reachable, got %v", update.Addresses)
+			}
+			expectEvent(t, m, EndpointDegraded)
+
+			prober.set("10.0.0.1", ProbeResult{Result: results.Success, Latency: time.Millisecond})
+			for i := 1; i < tt.budget.RecoveryThreshold; i++ {
+				probeAll(w)
+				if update, _ := resultsManager.last(); !reflect.DeepEqual(update.DegradedAddresses, []string{"10.0.0.1"}) {
+					t.Fatalf("expected 10.0.0.1 to stay degraded after %d probes within the budget, got %v",
+						i, update.DegradedAddresses)
+				}
+			}
+			expectNoEvent(t, m)
+
+			probeAll(w)
+			update, _ = resultsManager.last()
+			if len(update.DegradedAddresses) != 0 || update.Result != results.Success {
+				t.Errorf("expected 10.0.0.1 to be within the budget after %d probes, got %v (%s)",
+					tt.budget.RecoveryThreshold, update.DegradedAddresses, update.Result)
+			}
+			expectEvent(t, m, EndpointWithinBudget)
+		})
+	}
+}
+
+func TestWorkerUnreachableAddressIsNotDegraded(t *testing.T) {
+	m, resultsManager := newTestManager()
+	prober := newFakeProber()
+	spec := newTestProbe()
+	spec.Degraded.MaxLatency = 100 * time.Millisecond
+	w := newWorker(m, []string{"10.0.0.1"}, nil, nil, newTestServiceImport(), spec, prober)
+	w.start()
+
+	prober.set("10.0.0.1", ProbeResult{Result: results.Success, Latency: 200 * time.Millisecond})
+	for i := 0; i < spec.Degraded.Threshold; i++ {
+		probeAll(w)
+	}
+	prober.set("10.0.0.1", ProbeResult{Result: results.Failure, Detail: "timeout"})
+	for i := 0; i < spec.FailureThreshold; i++ {
+		probeAll(w)
+	}
+
+	update, _ := resultsManager.last()
+	if !reflect.DeepEqual(update.Addresses, []string{"10.0.0.1"}) || len(update.DegradedAddresses) != 0 {
+		t.Errorf("expected 10.0.0.1 to be published as unreachable only, got %v and degraded %v",
+			update.Addresses, update.DegradedAddresses)
+	}
+	if update.Result != results.Failure {
+		t.Errorf("expected result %s, got %s", results.Failure, update.Result)
+	}
+}
+
+func TestWorkerMaxUnreachablePercentOnlyCapsUnreachableAddresses(t *testing.T) {
+	m, resultsManager := newTestManager()
+	prober := newFakeProber()
+	spec := newTestProbe()
+	spec.MaxUnreachablePercent = 50
+	spec.Degraded.MaxLatency = 100 * time.Millisecond
+	w := newWorker(m, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}, nil, nil, newTestServiceImport(), spec, prober)
+	w.start()
+
+	failure := ProbeResult{Result: results.Failure, Detail: "timeout"}
+	prober.set("10.0.0.1", failure)
+	prober.set("10.0.0.2", failure)
+	for i := 0; i < spec.FailureThreshold; i++ {
+		probeAll(w)
+	}
+	if update, _ := resultsManager.last(); !reflect.DeepEqual(update.Addresses, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Fatalf("expected 10.0.0.1 and 10.0.0.2 to be unreachable within the guard, got %v", update.Addresses)
+	}
+
+	// Three of four addresses exceed the guard of half the addresses, while the last one gets degraded.
+	prober.set("10.0.0.3", failure)
+	prober.set("10.0.0.4", ProbeResult{Result: results.Success, Latency: 200 * time.Millisecond})
+	for i := 0; i < spec.FailureThreshold; i++ {
+		probeAll(w)
+	}
+
+	update, _ := resultsManager.last()
+	if !reflect.DeepEqual(update.Addresses, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("expected the published unreachable addresses to be kept, got %v", update.Addresses)
+	}
+	if !reflect.DeepEqual(update.DegradedAddresses, []string{"10.0.0.4"}) {
+		t.Errorf("expected the degraded address to be published, got %v", update.DegradedAddresses)
+	}
+	var suppressed []string
+	for _, s := range update.Statuses {
+		if s.Suppressed {
+			suppressed = append(suppressed, s.Address)
+		}
+	}
+	sort.Strings(suppressed)
+	if !reflect.DeepEqual(suppressed, []string{"10.0.0.3"}) {
+		t.Errorf("expected the status of 10.0.0.3 to be suppressed, got %v", suppressed)
+	}
+
+	// Once an address recovers, the unreachable addresses are within the guard again.
+	prober.set("10.0.0.2", ProbeResult{Result: results.Success, Latency: time.Millisecond})
+	for i := 0; i < spec.SuccessThreshold; i++ {
+		probeAll(w)
+	}
+	if update, _ := resultsManager.last(); !reflect.DeepEqual(update.Addresses, []string{"10.0.0.1", "10.0.0.3"}) {
+		t.Errorf("expected 10.0.0.1 and 10.0.0.3 to be unreachable, got %v", update.Addresses)
+	}
+}
+
+func TestWorkerStatusReportPeriod(t *testing.T) {
+	for _, period := range []time.Duration{0, time.Minute} {
+		m, resultsManager := newTestManager()
+		m.spec.StatusReportPeriod = period
+		w := newWorker(m, []string{"10.0.0.1"}, nil, nil, newTestServiceImport(), newTestProbe(), newFakeProber())
+		w.start()
+		probeAll(w)
+		_, n := resultsManager.last()
+
+		// The result of the address doesn't change, only the status report may publish it again.
+		w.lock.Lock()
+		target := w.targets["10.0.0.1"]
+		w.lock.Unlock()
+		w.observe(target, ProbeResult{Result: results.Success, Latency: time.Millisecond}, time.Now().Add(2*time.Minute))
+
+		_, after := resultsManager.last()
+		if published := after > n; published != (period > 0) {
+			t.Errorf("expected the statuses to be published again %t with a report period of %s, got %t",
+				period > 0, period, published)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "eps_probe"
+
+var (
+	// ICMPMode reports the ICMP mode the plugin is running with, the active mode is set to 1.
+	ICMPMode = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "icmp_mode",
+		Help:      "ICMP mode used for probing, 1 for the active mode (privileged or unprivileged).",
+	}, []string{"mode"})
+
+	// ICMPPendingEchos is the number of echo requests of the shared ICMP sockets waiting for a reply.
+	ICMPPendingEchos = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "icmp_pending_echos",
+		Help:      "Number of echo requests sent over the shared ICMP sockets waiting for a reply.",
+	})
+
+	// ProbeDuration is the duration of a single probe of an address.
+	ProbeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "probe_duration_seconds",
+		Help:      "Duration of probing a single address.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"type"})
+
+	// ProbeResults counts the probe results per address.
+	ProbeResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "probe_results_total",
+		Help:      "Number of probe results per ServiceImport address.",
+	}, []string{"namespace", "serviceimport", "address", "result"})
+
+	// ProbeConsecutiveFailures is the number of consecutive failed probes per address.
+	ProbeConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "probe_consecutive_failures",
+		Help:      "Number of consecutive failed probes per ServiceImport address.",
+	}, []string{"namespace", "serviceimport", "address"})
+
+	// ProbePacketLoss is the packet loss ratio of the last probe per address, for probes sending several packets.
+	ProbePacketLoss = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "probe_packet_loss_ratio",
+		Help:      "Ratio of lost packets of the last probe per ServiceImport address.",
+	}, []string{"namespace", "serviceimport", "address"})
+
+	// ProbeRTT is the average round trip time of the last probe per address, for probes sending several packets.
+	ProbeRTT = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "probe_rtt_seconds",
+		Help:      "Average round trip time of the last probe per ServiceImport address.",
+	}, []string{"namespace", "serviceimport", "address"})
+
+	// ProbeSchedulingDelay is how late probe rounds start after they are due.
+	ProbeSchedulingDelay = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "probe_scheduling_delay_seconds",
+		Help:      "Delay between when a probe round is due and when it is started.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+
+	// ProbeTargets is the number of probed targets, an address probed the same way for several
+	// ServiceImports is a single target.
+	ProbeTargets = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "probe_targets",
+		Help:      "Number of unique probed addresses and probe configurations.",
+	})
+
+	// ProbeWorkers is the number of active probe workers.
+	ProbeWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "probe_workers",
+		Help:      "Number of active probe workers, one per ServiceImport.",
+	})
+
+	// ResultsQueueDepth is the number of serviceImports with a probe result update waiting to be consumed.
+	ResultsQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "results_queue_depth",
+		Help:      "Number of ServiceImports with a probe result update waiting to be consumed.",
+	})
+
+	// ResultsUpdateLatency is the time from a probe result change until it has been handed to the writers.
+	ResultsUpdateLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "results_update_latency_seconds",
+		Help:      "Time from a change of the probe results until it has been handed to the annotation writer.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+
+	// AnnotationWrites counts the annotation writes to the apiserver by result.
+	AnnotationWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "annotation_writes_total",
+		Help:      "Number of ServiceImport annotation writes, by result (success or failure).",
+	}, []string{"result"})
+
+	// AnnotationWriteDuration is the duration of annotation writes to the apiserver.
+	AnnotationWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "annotation_write_duration_seconds",
+		Help:      "Duration of ServiceImport annotation writes.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// StatusWrites counts the EndpointProbeStatus writes to the apiserver by result.
+	StatusWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_writes_total",
+		Help:      "Number of EndpointProbeStatus writes, by result (success or failure).",
+	}, []string{"result"})
+
+	// StatusWriteDuration is the duration of EndpointProbeStatus writes to the apiserver.
+	StatusWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "status_write_duration_seconds",
+		Help:      "Duration of EndpointProbeStatus writes.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// EndpointSliceWrites counts the EndpointSlice writes to the apiserver by result.
+	EndpointSliceWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "endpointslice_writes_total",
+		Help:      "Number of EndpointSlice endpoint condition writes, by result (success or failure).",
+	}, []string{"result"})
+
+	// EndpointSliceWriteDuration is the duration of EndpointSlice writes to the apiserver.
+	EndpointSliceWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "endpointslice_write_duration_seconds",
+		Help:      "Duration of EndpointSlice endpoint condition writes.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		ICMPMode,
+		ICMPPendingEchos,
+		ProbeDuration,
+		ProbeResults,
+		ProbeConsecutiveFailures,
+		ProbePacketLoss,
+		ProbeRTT,
+		ProbeSchedulingDelay,
+		ProbeTargets,
+		ProbeWorkers,
+		ResultsQueueDepth,
+		ResultsUpdateLatency,
+		AnnotationWrites,
+		AnnotationWriteDuration,
+		StatusWrites,
+		StatusWriteDuration,
+		EndpointSliceWrites,
+		EndpointSliceWriteDuration,
+	)
+}
+
+// DeleteAddress removes the series of an address which is no longer probed.
+func DeleteAddress(svcImportNamespace, svcImportName, address string) {
+	labels := prometheus.Labels{"namespace": svcImportNamespace, "serviceimport": svcImportName, "address": address}
+	ProbeResults.DeletePartialMatch(labels)
+	ProbeConsecutiveFailures.DeletePartialMatch(labels)
+	ProbePacketLoss.DeletePartialMatch(labels)
+	ProbeRTT.DeletePartialMatch(labels)
+}
+
+// DeleteServiceImport removes the series of a ServiceImport which is no longer probed.
+func DeleteServiceImport(svcImportNamespace, svcImportName string) {
+	labels := prometheus.Labels{"namespace": svcImportNamespace, "serviceimport": svcImportName}
+	ProbeResults.DeletePartialMatch(labels)
+	ProbeConsecutiveFailures.DeletePartialMatch(labels)
+	ProbePacketLoss.DeletePartialMatch(labels)
+	ProbeRTT.DeletePartialMatch(labels)
+}
@@ -2,107 +2,239 @@ package annotation
 
 import (
 	"context"
+	"encoding/json"
+	"sort"
 	"strings"
 	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/syncer"
 )
 
 type Manager interface {
-	Start()
+	// Start syncs the desired annotations with the apiserver until stopCh is closed.
+	Start(stopCh <-chan struct{})
 
-	Set(uid types.UID, addrs []string, svcImportName, svcImportNamespace string)
+	// Set records the desired unreachable addresses, degraded addresses and address statuses of the serviceImport
+	// and queues a sync.
+	Set(uid types.UID, addrs, degradedAddrs []string, statuses []results.AddressStatus, svcImportName, svcImportNamespace string)
 
-	syncAnnotation(uid types.UID, status annotationStatus)
+	syncAnnotation(key types.NamespacedName, status annotationStatus) (bool, error)
 }
 
 type annotationStatus struct {
-	Addresses     []string
-	SvcImportName string
-	Namespace     string
-}
-
-type serviceImportAnnotationSyncRequest struct {
-	serviceImportUID types.UID
-	status           annotationStatus
+	Addresses         []string
+	DegradedAddresses []string
+	Statuses          []results.AddressStatus
+	SvcImportName     string
+	Namespace         string
 }
 
 type manager struct {
 	client client.Client
 
-	serviceImportAnnotationChannel chan serviceImportAnnotationSyncRequest
+	// syncer syncs the desired annotation status of every serviceImport
+	syncer *syncer.Syncer[annotationStatus]
 }
 
 func NewManager(client client.Client) Manager {
-	return &manager{
-		client:                         client,
-		serviceImportAnnotationChannel: make(chan serviceImportAnnotationSyncRequest, 1000),
-	}
+	m := &manager{client: client}
+	m.syncer = syncer.New[annotationStatus]("annotation", syncPeriod, m.syncAnnotation)
+	return m
 }
 
+// syncPeriod is how often every desired annotation is synced again, repairing changes made by others.
+// ServiceImports are read from the informer cache, so a resync without changes does not reach the apiserver.
 const syncPeriod = 10 * time.Second
 
-func (m *manager) Start() {
+func (m *manager) Start(stopCh <-chan struct{}) {
 	if m.client == nil {
-		klog.InfoS("kubernetes client is nil, not starting status manager")
+		klog.InfoS("kubernetes client is nil, not starting annotation manager")
 		return
 	}
 
 	klog.InfoS("Starting to sync serviceImport annotation with apiserver")
-
-	syncTicker := time.NewTicker(syncPeriod)
-
-	// syncServiceImport and syncBatch share the same go routine to avoid sync races.
-	go wait.Forever(func() {
-		for {
-			select {
-			case syncRequest := <-m.serviceImportAnnotationChannel:
-				klog.V(3).InfoS("Annotation manager: syncing serviceImport with status from serviceImportAnnotationChannel",
-					"serviceImportUID", syncRequest.serviceImportUID)
-				m.syncAnnotation(syncRequest.serviceImportUID, syncRequest.status)
-			case <-syncTicker.C:
-			}
-		}
-	}, 0)
+	m.syncer.Run(stopCh)
 }
 
-func (m *manager) Set(uid types.UID, addrs []string, svcImportName, svcImportNamespace string) {
-	m.serviceImportAnnotationChannel <- serviceImportAnnotationSyncRequest{
-		serviceImportUID: uid,
-		status: annotationStatus{
-			Addresses:     addrs,
-			SvcImportName: svcImportName,
-			Namespace:     svcImportNamespace,
-		},
-	}
+func (m *manager) Set(uid types.UID, addrs, degradedAddrs []string, statuses []results.AddressStatus,
+	svcImportName, svcImportNamespace string) {
+	key := types.NamespacedName{Namespace: svcImportNamespace, Name: svcImportName}
+	klog.V(3).InfoS("Annotation manager: queueing serviceImport annotation sync", "serviceImport", key, "serviceImportUID", uid)
+	m.syncer.Set(key, annotationStatus{
+		Addresses:         addrs,
+		DegradedAddresses: degradedAddrs,
+		Statuses:          statuses,
+		SvcImportName:     svcImportName,
+		Namespace:         svcImportNamespace,
+	})
 }
 
 const (
 	ServiceImportNotReachableEPSAddr = "kosmos.io/disconnected-address"
+
+	// ServiceImportDegradedEPSAddr lists the reachable addresses which exceed the latency or loss budget.
+	ServiceImportDegradedEPSAddr = "kosmos.io/degraded-address"
+
+	// ServiceImportProbeStatus holds the JSON encoded results.ProbeStatus of the probed addresses, truncated
+	// to keep the annotations of the serviceImport within their size limit.
+	ServiceImportProbeStatus = "kosmos.io/probe-status"
+
+	// FieldManager is the field manager of the annotations written by the plugin.
+	FieldManager = "eps-probe-plugin"
 )
 
-func (m *manager) syncAnnotation(uid types.UID, status annotationStatus) {
+// syncAnnotation writes the desired annotations of the serviceImport. It is done once the serviceImport
+// has been deleted.
+func (m *manager) syncAnnotation(key types.NamespacedName, status annotationStatus) (bool, error) {
 	svcImport := &v1alpha1.ServiceImport{}
-	if err := m.client.Get(context.TODO(), client.ObjectKey{
-		Name:      status.SvcImportName,
-		Namespace: status.Namespace,
-	}, svcImport); err != nil {
-		klog.V(3).ErrorS(err, "Could not get serviceImport annotation", "serviceImport", klog.KObj(svcImport))
-		return
+	if err := m.client.Get(context.TODO(), key, svcImport); err != nil {
+		if apierrors.IsNotFound(err) {
+			klog.V(3).InfoS("ServiceImport not found, dropping desired annotation", "serviceImport", key)
+			return true, nil
+		}
+		return false, err
 	}
 
 	if svcImport.DeletionTimestamp != nil {
-		return
+		return false, nil
 	}
 
-	svcImport.Annotations[ServiceImportNotReachableEPSAddr] = strings.Join(status.Addresses, ",")
-	if err := m.client.Update(context.TODO(), svcImport); err != nil {
-		klog.V(3).ErrorS(err, "Could not update serviceImport annotation", "serviceImport", klog.KObj(svcImport))
-		return
+	// The annotation is removed entirely when no address is unreachable.
+	var value *string
+	if len(status.Addresses) > 0 {
+		joined := strings.Join(status.Addresses, ",")
+		value = &joined
+	}
+	// The degraded annotation is removed entirely when no address is degraded.
+	var degradedValue *string
+	if len(status.DegradedAddresses) > 0 {
+		joined := strings.Join(status.DegradedAddresses, ",")
+		degradedValue = &joined
+	}
+	statusValue, err := encodeProbeStatus(status.Statuses)
+	if err != nil {
+		return false, err
+	}
+
+	// The addresses are patched before the statuses, so they are published even if the statuses can't be.
+	if err := m.syncAnnotations(svcImport, map[string]*string{
+		ServiceImportNotReachableEPSAddr: value,
+		ServiceImportDegradedEPSAddr:     degradedValue,
+	}); err != nil {
+		return false, err
 	}
+	return false, m.syncAnnotations(svcImport, map[string]*string{ServiceImportProbeStatus: statusValue})
+}
+
+// maxProbeStatusSize is the maximum size of the encoded status annotation. All annotations of an object
+// together must not exceed 256KiB, so the status leaves half of it to the other annotations.
+const maxProbeStatusSize = 128 * 1024
+
+// encodeProbeStatus encodes the address statuses, nil if no address is probed. If the encoded statuses
+// exceed maxProbeStatusSize, the statuses of reachable addresses are left out first, then those of the
+// other addresses, and the status is flagged as truncated.
+func encodeProbeStatus(statuses []results.AddressStatus) (*string, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(results.ProbeStatus{Addresses: statuses})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxProbeStatusSize {
+		if data, err = truncateProbeStatus(statuses); err != nil {
+			return nil, err
+		}
+	}
+	encoded := string(data)
+	return &encoded, nil
+}
+
+// truncateProbeStatus encodes as many address statuses as fit into maxProbeStatusSize, keeping those of
+// unreachable, suppressed and degraded addresses first. The kept statuses stay sorted by address.
+func truncateProbeStatus(statuses []results.AddressStatus) ([]byte, error) {
+	byPriority := make([]int, 0, len(statuses))
+	for i, s := range statuses {
+		if !s.Reachable || s.Suppressed || s.Degraded {
+			byPriority = append(byPriority, i)
+		}
+	}
+	for i, s := range statuses {
+		if s.Reachable && !s.Suppressed && !s.Degraded {
+			byPriority = append(byPriority, i)
+		}
+	}
+
+	encode := func(n int) ([]byte, error) {
+		kept := append([]int{}, byPriority[:n]...)
+		sort.Ints(kept)
+		status := results.ProbeStatus{Addresses: make([]results.AddressStatus, 0, n), Truncated: true}
+		for _, i := range kept {
+			status.Addresses = append(status.Addresses, statuses[i])
+		}
+		return json.Marshal(status)
+	}
+
+	// Find the most statuses which fit, the encoded size grows with every status.
+	var encodeErr error
+	n := sort.Search(len(byPriority)+1, func(n int) bool {
+		data, err := encode(n)
+		if err != nil {
+			encodeErr = err
+		}
+		return len(data) > maxProbeStatusSize
+	}) - 1
+	if encodeErr != nil {
+		return nil, encodeErr
+	}
+	return encode(n)
+}
+
+// syncAnnotations patches the annotations of the serviceImport which differ from the given ones. A nil
+// value removes the annotation.
+func (m *manager) syncAnnotations(svcImport *v1alpha1.ServiceImport, desired map[string]*string) error {
+	annotations := map[string]*string{}
+	for k, v := range desired {
+		current, exists := svcImport.Annotations[k]
+		if (v == nil && !exists) || (v != nil && exists && current == *v) {
+			continue
+		}
+		annotations[k] = v
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	err := m.patchAnnotations(svcImport, annotations)
+	metrics.AnnotationWriteDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.AnnotationWrites.WithLabelValues("failure").Inc()
+		return err
+	}
+	metrics.AnnotationWrites.WithLabelValues("success").Inc()
 	klog.V(3).InfoS("Success to update serviceImport annotation", "serviceImport", klog.KObj(svcImport))
+	return nil
+}
+
+// patchAnnotations sets the given annotations of the serviceImport with a merge patch, leaving the rest of the
+// object untouched. A nil value removes the annotation.
+func (m *manager) patchAnnotations(svcImport *v1alpha1.ServiceImport, annotations map[string]*string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return m.client.Patch(context.TODO(), svcImport, client.RawPatch(types.MergePatchType, patch), client.FieldOwner(FieldManager))
 }
@@ -0,0 +1,196 @@
+package annotation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/util/fakeclient"
+)
+
+func TestSyncAnnotationClearsRemovedAddresses(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "svc"}
+	svcImport := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{
+		Name:      key.Name,
+		Namespace: key.Namespace,
+		Annotations: map[string]string{
+			ServiceImportNotReachableEPSAddr: "10.0.0.2",
+			ServiceImportDegradedEPSAddr:     "10.0.0.3",
+			"other":                          "kept",
+		},
+	}}
+	cli := fakeclient.NewClient(svcImport)
+	m := NewManager(cli).(*manager)
+
+	m.Set("", []string{}, []string{}, []results.AddressStatus{{Address: "10.0.0.1", Reachable: true}}, key.Name, key.Namespace)
+	if err := m.syncer.Sync(key); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &v1alpha1.ServiceImport{}
+	if err := cli.Get(context.TODO(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{ServiceImportNotReachableEPSAddr, ServiceImportDegradedEPSAddr} {
+		if v, ok := got.Annotations[k]; ok {
+			t.Errorf("expected annotation %s to be removed, got %q", k, v)
+		}
+	}
+	if _, ok := got.Annotations[ServiceImportProbeStatus]; !ok {
+		t.Errorf("expected annotation %s to be set", ServiceImportProbeStatus)
+	}
+	if got.Annotations["other"] != "kept" {
+		t.Errorf("expected foreign annotations to be kept, got %v", got.Annotations)
+	}
+}
+
+// newSizeLimitedClient returns a client rejecting annotation patches which make the annotations of an
+// object exceed the size limit of the apiserver. Patches of the probe status fail if failStatus is set.
+func newSizeLimitedClient(t *testing.T, failStatus bool, objs ...client.Object) client.Client {
+	return interceptor.NewClient(fakeclient.NewClient(objs...), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			data, err := patch.Data(obj)
+			if err != nil {
+				return err
+			}
+			var p struct {
+				Metadata struct {
+					Annotations map[string]*string `json:"annotations"`
+				} `json:"metadata"`
+			}
+			if err := json.Unmarshal(data, &p); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := p.Metadata.Annotations[ServiceImportProbeStatus]; ok && failStatus {
+				return apierrors.NewInternalError(errors.New("status patch failed"))
+			}
+			annotations := map[string]string{}
+			for k, v := range obj.GetAnnotations() {
+				annotations[k] = v
+			}
+			for k, v := range p.Metadata.Annotations {
+				if v == nil {
+					delete(annotations, k)
+					continue
+				}
+				annotations[k] = *v
+			}
+			if err := apimachineryvalidation.ValidateAnnotationsSize(annotations); err != nil {
+				return apierrors.NewBadRequest(err.Error())
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	})
+}
+
+// newAddressStatuses returns the statuses of n addresses, every tenth of them unreachable.
+func newAddressStatuses(n int) ([]results.AddressStatus, []string) {
+	now := metav1.Now()
+	var statuses []results.AddressStatus
+	var unreachable []string
+	for i := 0; i < n; i++ {
+		address := fmt.Sprintf("10.%d.%d.%d", i>>16, (i>>8)&0xff, i&0xff)
+		status := results.AddressStatus{
+			Address:              address,
+			Reachable:            i%10 != 0,
+			LastResult:           "success",
+			ConsecutiveSuccesses: 3,
+			LastProbeTime:        &now,
+			LastTransitionTime:   &now,
+		}
+		if !status.Reachable {
+			status.LastResult, status.ConsecutiveSuccesses, status.ConsecutiveFailures = "failure", 0, 3
+			status.Reason = "connect to port 80 failed: i/o timeout"
+			unreachable = append(unreachable, address)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Address < statuses[j].Address })
+	sort.Strings(unreachable)
+	return statuses, unreachable
+}
+
+func TestSyncAnnotationTruncatesOversizedStatus(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "svc"}
+	svcImport := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	cli := newSizeLimitedClient(t, false, svcImport)
+	m := NewManager(cli).(*manager)
+
+	statuses, unreachable := newAddressStatuses(5000)
+	if data, _ := json.Marshal(results.ProbeStatus{Addresses: statuses}); len(data) <= apimachineryvalidation.TotalAnnotationSizeLimitB {
+		t.Fatalf("expected the statuses to exceed the annotation size limit, got %d bytes", len(data))
+	}
+	m.Set("", unreachable, nil, statuses, key.Name, key.Namespace)
+	if err := m.syncer.Sync(key); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &v1alpha1.ServiceImport{}
+	if err := cli.Get(context.TODO(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Annotations[ServiceImportNotReachableEPSAddr]; v != strings.Join(unreachable, ",") {
+		t.Errorf("expected all %d unreachable addresses to be published", len(unreachable))
+	}
+	encoded := got.Annotations[ServiceImportProbeStatus]
+	if len(encoded) > maxProbeStatusSize {
+		t.Errorf("expected the status to be at most %d bytes, got %d", maxProbeStatusSize, len(encoded))
+	}
+	status := results.ProbeStatus{}
+	if err := json.Unmarshal([]byte(encoded), &status); err != nil {
+		t.Fatal(err)
+	}
+	if !status.Truncated || len(status.Addresses) == 0 || len(status.Addresses) >= len(statuses) {
+		t.Fatalf("expected a truncated status, got %d of %d statuses, truncated %t",
+			len(status.Addresses), len(statuses), status.Truncated)
+	}
+	if !sort.SliceIsSorted(status.Addresses, func(i, j int) bool { return status.Addresses[i].Address < status.Addresses[j].Address }) {
+		t.Errorf("expected the kept statuses to be sorted by address")
+	}
+	kept := map[string]bool{}
+	for _, s := range status.Addresses {
+		kept[s.Address] = true
+	}
+	for _, address := range unreachable {
+		if !kept[address] {
+			t.Errorf("expected the status of unreachable address %s to be kept", address)
+		}
+	}
+}
+
+func TestSyncAnnotationPublishesAddressesWhenStatusFails(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "svc"}
+	svcImport := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	cli := newSizeLimitedClient(t, true, svcImport)
+	m := NewManager(cli).(*manager)
+
+	statuses, unreachable := newAddressStatuses(20)
+	m.Set("", unreachable, nil, statuses, key.Name, key.Namespace)
+	if err := m.syncer.Sync(key); err == nil {
+		t.Errorf("expected the failed status patch to be returned")
+	}
+
+	got := &v1alpha1.ServiceImport{}
+	if err := cli.Get(context.TODO(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Annotations[ServiceImportNotReachableEPSAddr]; v != strings.Join(unreachable, ",") {
+		t.Errorf("expected the unreachable addresses to be published, got %q", v)
+	}
+	if _, ok := got.Annotations[ServiceImportProbeStatus]; ok {
+		t.Errorf("expected no status to be written")
+	}
+}
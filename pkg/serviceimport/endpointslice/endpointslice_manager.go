@@ -0,0 +1,210 @@
+package endpointslice
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/syncer"
+)
+
+// Manager marks the endpoints of the EndpointSlices of a serviceImport not ready while their addresses are
+// unreachable, so kube-proxy and CoreDNS stop routing to them.
+type Manager interface {
+	// Start syncs the desired endpoint conditions with the apiserver until stopCh is closed.
+	Start(stopCh <-chan struct{})
+
+	// Set records the unreachable addresses of the serviceImport and queues a sync.
+	Set(addrs []string, svcImportName, svcImportNamespace string)
+
+	// Remove marks the endpoints marked not ready for the removed serviceImport ready again.
+	Remove(svcImportName, svcImportNamespace string)
+
+	syncEndpointSlices(key types.NamespacedName, addrs []string) (bool, error)
+}
+
+const (
+	// NotReadyAddresses lists the addresses of an EndpointSlice the plugin has marked not ready. Only
+	// ready endpoints are marked, so the endpoints of these addresses are marked ready again on recovery.
+	NotReadyAddresses = "kosmos.io/probe-not-ready-addresses"
+
+	// FieldManager is the field manager of the EndpointSlice changes written by the plugin.
+	FieldManager = "eps-probe-plugin"
+)
+
+type manager struct {
+	client client.Client
+
+	// syncer syncs the unreachable addresses of every serviceImport
+	syncer *syncer.Syncer[[]string]
+}
+
+func NewManager(client client.Client) Manager {
+	m := &manager{client: client}
+	m.syncer = syncer.New[[]string]("endpointslice", syncPeriod, m.syncEndpointSlices)
+	return m
+}
+
+// syncPeriod is how often the EndpointSlices of every serviceImport are synced again, marking the
+// endpoints again after the owner of the EndpointSlice has rewritten them.
+const syncPeriod = 10 * time.Second
+
+func (m *manager) Start(stopCh <-chan struct{}) {
+	if m.client == nil {
+		klog.InfoS("kubernetes client is nil, not starting endpointSlice manager")
+		return
+	}
+
+	klog.InfoS("Starting to sync endpointSlice conditions with apiserver")
+	m.syncer.Run(stopCh)
+}
+
+func (m *manager) Set(addrs []string, svcImportName, svcImportNamespace string) {
+	key := types.NamespacedName{Namespace: svcImportNamespace, Name: svcImportName}
+	klog.V(3).InfoS("EndpointSlice manager: queueing endpointSlice sync", "serviceImport", key)
+	m.syncer.Set(key, addrs)
+}
+
+func (m *manager) Remove(svcImportName, svcImportNamespace string) {
+	// Without unreachable addresses every marked endpoint is restored, then the serviceImport is forgotten.
+	m.Set([]string{}, svcImportName, svcImportNamespace)
+}
+
+// RestoreEndpointSlices marks the endpoints marked not ready by the plugin ready again in the EndpointSlices
+// of every serviceImport. It undoes the marks of a previous run, once marking endpoints has been disabled.
+func RestoreEndpointSlices(ctx context.Context, c client.Client, reader client.Reader) error {
+	sliceList := &discoveryv1.EndpointSliceList{}
+	if err := reader.List(ctx, sliceList, client.HasLabels{v1alpha1.LabelServiceName}); err != nil {
+		return err
+	}
+
+	m := &manager{client: c}
+	var errs []error
+	for i := range sliceList.Items {
+		slice := &sliceList.Items[i]
+		if _, exists := slice.Annotations[NotReadyAddresses]; !exists {
+			continue
+		}
+		if err := m.syncEndpointSlice(slice, sets.New[string]()); err != nil {
+			// Without the permission to update one EndpointSlice, none of them can be restored.
+			if apierrors.IsForbidden(err) {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// syncEndpointSlices marks the endpoints of the unreachable addresses of the serviceImport not ready. It
+// is done once every address is reachable and no endpoint is left to restore.
+func (m *manager) syncEndpointSlices(key types.NamespacedName, addrs []string) (bool, error) {
+	// Results of a removed serviceImport may still arrive, its endpoints are restored regardless.
+	svcImport := &v1alpha1.ServiceImport{}
+	if err := m.client.Get(context.TODO(), key, svcImport); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, err
+		}
+		addrs = nil
+	} else if svcImport.DeletionTimestamp != nil {
+		addrs = nil
+	}
+
+	sliceList := &discoveryv1.EndpointSliceList{}
+	if err := m.client.List(context.TODO(), sliceList, client.InNamespace(key.Namespace),
+		client.MatchingLabels{v1alpha1.LabelServiceName: key.Name}); err != nil {
+		return false, err
+	}
+
+	unreachable := sets.New[string](addrs...)
+	marked := false
+	for i := range sliceList.Items {
+		slice := &sliceList.Items[i]
+		if err := m.syncEndpointSlice(slice, unreachable); err != nil {
+			return false, err
+		}
+		if _, exists := slice.Annotations[NotReadyAddresses]; exists {
+			marked = true
+		}
+	}
+
+	// Nothing is left to restore once every address is reachable again.
+	return len(addrs) == 0 && !marked, nil
+}
+
+// syncEndpointSlice marks the ready endpoints of the slice with an unreachable address not ready, and the
+// endpoints it has marked before ready again once all their addresses are reachable.
+func (m *manager) syncEndpointSlice(slice *discoveryv1.EndpointSlice, unreachable sets.Set[string]) error {
+	previous := sets.New[string]()
+	if value, exists := slice.Annotations[NotReadyAddresses]; exists && value != "" {
+		previous.Insert(strings.Split(value, ",")...)
+	}
+
+	original := slice.DeepCopy()
+	current := sets.New[string]()
+	for i := range slice.Endpoints {
+		endpoint := &slice.Endpoints[i]
+		wasMarked := previous.HasAny(endpoint.Addresses...)
+		if unreachable.HasAny(endpoint.Addresses...) {
+			// Endpoints not ready by their owner are left alone, so they are never marked ready by us.
+			if !wasMarked && !isReady(endpoint) {
+				continue
+			}
+			setConditions(endpoint, false)
+			current.Insert(endpoint.Addresses...)
+		} else if wasMarked {
+			setConditions(endpoint, true)
+		}
+	}
+
+	if current.Len() > 0 {
+		if slice.Annotations == nil {
+			slice.Annotations = map[string]string{}
+		}
+		addresses := current.UnsortedList()
+		sort.Strings(addresses)
+		slice.Annotations[NotReadyAddresses] = strings.Join(addresses, ",")
+	} else {
+		delete(slice.Annotations, NotReadyAddresses)
+	}
+
+	if reflect.DeepEqual(original.Endpoints, slice.Endpoints) && reflect.DeepEqual(original.Annotations, slice.Annotations) {
+		return nil
+	}
+
+	start := time.Now()
+	err := m.client.Patch(context.TODO(), slice, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}),
+		client.FieldOwner(FieldManager))
+	metrics.EndpointSliceWriteDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.EndpointSliceWrites.WithLabelValues("failure").Inc()
+		return err
+	}
+	metrics.EndpointSliceWrites.WithLabelValues("success").Inc()
+	klog.V(3).InfoS("Success to update endpointSlice conditions", "endpointSlice", klog.KObj(slice),
+		"not ready addresses", slice.Annotations[NotReadyAddresses])
+	return nil
+}
+
+// isReady follows the EndpointSlice API, where a nil ready condition means ready.
+func isReady(endpoint *discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
+
+func setConditions(endpoint *discoveryv1.Endpoint, ready bool) {
+	endpoint.Conditions.Ready = &ready
+	serving := ready
+	endpoint.Conditions.Serving = &serving
+}
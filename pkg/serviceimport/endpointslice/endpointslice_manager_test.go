@@ -0,0 +1,76 @@
+package endpointslice
+
+import (
+	"context"
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/util/fakeclient"
+)
+
+// newMarkedEndpointSlice returns an EndpointSlice of the serviceImport whose first address has been marked
+// not ready by the plugin.
+func newMarkedEndpointSlice(name, svcImportName string) *discoveryv1.EndpointSlice {
+	notReady := false
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "ns",
+			Labels:      map[string]string{v1alpha1.LabelServiceName: svcImportName},
+			Annotations: map[string]string{NotReadyAddresses: "10.0.0.1"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady, Serving: &notReady}},
+			{Addresses: []string{"10.0.0.2"}},
+		},
+	}
+}
+
+func expectRestored(t *testing.T, cli client.Client, name string) {
+	t.Helper()
+	slice := &discoveryv1.EndpointSlice{}
+	if err := cli.Get(context.TODO(), types.NamespacedName{Namespace: "ns", Name: name}, slice); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := slice.Annotations[NotReadyAddresses]; exists {
+		t.Errorf("expected annotation %s to be removed from %s", NotReadyAddresses, name)
+	}
+	if !isReady(&slice.Endpoints[0]) {
+		t.Errorf("expected the endpoint of 10.0.0.1 in %s to be ready again", name)
+	}
+}
+
+func TestSyncEndpointSlicesRestoresRemovedServiceImport(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "svc"}
+	cli := fakeclient.NewClient(newMarkedEndpointSlice("svc-1", key.Name))
+	m := NewManager(cli).(*manager)
+
+	// A result of the worker of the serviceImport arrives after the serviceImport was removed.
+	m.Remove(key.Name, key.Namespace)
+	m.Set([]string{"10.0.0.1"}, key.Name, key.Namespace)
+	if err := m.syncer.Sync(key); err != nil {
+		t.Fatal(err)
+	}
+	expectRestored(t, cli, "svc-1")
+
+	if _, ok := m.syncer.Get(key); ok {
+		t.Errorf("expected the removed serviceImport to be forgotten")
+	}
+}
+
+func TestRestoreEndpointSlices(t *testing.T) {
+	svcImport := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}}
+	cli := fakeclient.NewClient(svcImport, newMarkedEndpointSlice("svc-1", "svc"), newMarkedEndpointSlice("other-1", "other"))
+
+	if err := RestoreEndpointSlices(context.TODO(), cli, cli); err != nil {
+		t.Fatal(err)
+	}
+	expectRestored(t, cli, "svc-1")
+	expectRestored(t, cli, "other-1")
+}
@@ -0,0 +1,104 @@
+package serviceimport
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober"
+)
+
+// resolveProbePolicy returns the ProbePolicy applied to the serviceImport, nil if no policy selects it or
+// ProbePolicies are disabled.
+// If several policies select the serviceImport, the one with the highest priority wins and ties are
+// broken by the lexically smallest name.
+func (r *Reconciler) resolveProbePolicy(ctx context.Context, svcImport *v1alpha1.ServiceImport) (*kosmosv1alpha1.ProbePolicy, error) {
+	if !r.Controller.enableProbePolicy {
+		return nil, nil
+	}
+
+	policies := &kosmosv1alpha1.ProbePolicyList{}
+	if err := r.Controller.client.List(ctx, policies); err != nil {
+		return nil, err
+	}
+	if len(policies.Items) == 0 {
+		return nil, nil
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := r.Controller.client.Get(ctx, client.ObjectKey{Name: svcImport.Namespace}, namespace); err != nil {
+		return nil, err
+	}
+
+	var selected *kosmosv1alpha1.ProbePolicy
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		matched, err := probePolicyMatches(policy, namespace, svcImport)
+		if err != nil {
+			klog.ErrorS(err, "Invalid selector in probePolicy", "probePolicy", policy.Name)
+			r.Controller.recorder.Eventf(policy, corev1.EventTypeWarning, prober.InvalidProbePolicy,
+				"Invalid selector, the policy selects no serviceImport: %v", err)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if selected == nil || policy.Spec.Priority > selected.Spec.Priority ||
+			(policy.Spec.Priority == selected.Spec.Priority && policy.Name < selected.Name) {
+			selected = policy
+		}
+	}
+	return selected, nil
+}
+
+func probePolicyMatches(policy *kosmosv1alpha1.ProbePolicy, namespace *corev1.Namespace, svcImport *v1alpha1.ServiceImport) (bool, error) {
+	namespaceSelector, err := selectorOrEverything(policy.Spec.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	svcImportSelector, err := selectorOrEverything(policy.Spec.ServiceImportSelector)
+	if err != nil {
+		return false, err
+	}
+	return namespaceSelector.Matches(labels.Set(namespace.Labels)) && svcImportSelector.Matches(labels.Set(svcImport.Labels)), nil
+}
+
+// selectorOrEverything converts the label selector, a nil selector selects everything.
+func selectorOrEverything(selector *metav1.LabelSelector) (labels.Selector, error) {
+	if selector == nil {
+		return labels.Everything(), nil
+	}
+	return metav1.LabelSelectorAsSelector(selector)
+}
+
+// serviceImportsForProbePolicy enqueues all serviceImports, since a changed probePolicy may both start
+// and stop selecting any of them.
+func (r *Reconciler) serviceImportsForProbePolicy(ctx context.Context, _ client.Object) []reconcile.Request {
+	return r.listServiceImports(ctx)
+}
+
+// serviceImportsForNamespace enqueues the serviceImports of a namespace whose labels have changed.
+func (r *Reconciler) serviceImportsForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listServiceImports(ctx, client.InNamespace(obj.GetName()))
+}
+
+func (r *Reconciler) listServiceImports(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+	svcImports := &v1alpha1.ServiceImportList{}
+	if err := r.Controller.client.List(ctx, svcImports, opts...); err != nil {
+		klog.ErrorS(err, "Could not list serviceImports")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(svcImports.Items))
+	for _, svcImport := range svcImports.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&svcImport)})
+	}
+	return requests
+}
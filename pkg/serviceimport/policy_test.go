@@ -0,0 +1,160 @@
+package serviceimport
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/util/fakeclient"
+)
+
+func newProbePolicy(name string, priority int32, namespaceLabels, svcImportLabels map[string]string) *kosmosv1alpha1.ProbePolicy {
+	policy := &kosmosv1alpha1.ProbePolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       kosmosv1alpha1.ProbePolicySpec{Priority: priority},
+	}
+	if namespaceLabels != nil {
+		policy.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: namespaceLabels}
+	}
+	if svcImportLabels != nil {
+		policy.Spec.ServiceImportSelector = &metav1.LabelSelector{MatchLabels: svcImportLabels}
+	}
+	return policy
+}
+
+func newPolicyReconciler(enabled bool, objs ...client.Object) (*Reconciler, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+	return &Reconciler{Controller: &Controller{
+		client:            fakeclient.NewClient(objs...),
+		recorder:          recorder,
+		enableProbePolicy: enabled,
+	}}, recorder
+}
+
+func TestResolveProbePolicy(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", Labels: map[string]string{"team": "web"}}}
+	svcImport := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{
+		Name:      "svc",
+		Namespace: "ns",
+		Labels:    map[string]string{"app": "web"},
+	}}
+
+	tests := []struct {
+		name     string
+		policies []*kosmosv1alpha1.ProbePolicy
+		want     string
+	}{
+		{
+			name: "no policy",
+		},
+		{
+			name:     "nil selectors select everything",
+			policies: []*kosmosv1alpha1.ProbePolicy{newProbePolicy("all", 0, nil, nil)},
+			want:     "all",
+		},
+		{
+			name: "namespace selector",
+			policies: []*kosmosv1alpha1.ProbePolicy{
+				newProbePolicy("db", 10, map[string]string{"team": "db"}, nil),
+				newProbePolicy("web", 0, map[string]string{"team": "web"}, nil),
+			},
+			want: "web",
+		},
+		{
+			name: "serviceImport selector",
+			policies: []*kosmosv1alpha1.ProbePolicy{
+				newProbePolicy("db", 10, nil, map[string]string{"app": "db"}),
+				newProbePolicy("web", 0, nil, map[string]string{"app": "web"}),
+			},
+			want: "web",
+		},
+		{
+			name: "both selectors must match",
+			policies: []*kosmosv1alpha1.ProbePolicy{
+				newProbePolicy("mismatch", 10, map[string]string{"team": "web"}, map[string]string{"app": "db"}),
+			},
+		},
+		{
+			name: "highest priority",
+			policies: []*kosmosv1alpha1.ProbePolicy{
+				newProbePolicy("a", 1, nil, nil),
+				newProbePolicy("b", 5, nil, nil),
+				newProbePolicy("c", 3, nil, nil),
+			},
+			want: "b",
+		},
+		{
+			name: "smallest name on equal priority",
+			policies: []*kosmosv1alpha1.ProbePolicy{
+				newProbePolicy("web-b", 5, nil, nil),
+				newProbePolicy("web-a", 5, nil, nil),
+				newProbePolicy("low", 1, nil, nil),
+			},
+			want: "web-a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{namespace, svcImport}
+			for _, policy := range tt.policies {
+				objs = append(objs, policy)
+			}
+			r, _ := newPolicyReconciler(true, objs...)
+
+			policy, err := r.resolveProbePolicy(context.TODO(), svcImport)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if policy != nil {
+				got = policy.Name
+			}
+			if got != tt.want {
+				t.Errorf("expected policy %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveProbePolicyDisabled(t *testing.T) {
+	svcImport := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}}
+	r, _ := newPolicyReconciler(false, svcImport, newProbePolicy("all", 0, nil, nil))
+
+	if policy, err := r.resolveProbePolicy(context.TODO(), svcImport); err != nil || policy != nil {
+		t.Errorf("expected no policy while policies are disabled, got %v, %v", policy, err)
+	}
+}
+
+func TestResolveProbePolicySkipsInvalidSelector(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+	svcImport := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}}
+	invalid := newProbePolicy("invalid", 10, nil, nil)
+	invalid.Spec.ServiceImportSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "app", Operator: "Matches"},
+	}}
+	r, recorder := newPolicyReconciler(true, namespace, svcImport, invalid, newProbePolicy("valid", 0, nil, nil))
+
+	policy, err := r.resolveProbePolicy(context.TODO(), svcImport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy == nil || policy.Name != "valid" {
+		t.Errorf("expected the valid policy, got %v", policy)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, prober.InvalidProbePolicy) {
+			t.Errorf("expected a %s event, got %q", prober.InvalidProbePolicy, event)
+		}
+	default:
+		t.Errorf("expected a %s event", prober.InvalidProbePolicy)
+	}
+}
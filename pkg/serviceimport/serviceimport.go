@@ -2,22 +2,34 @@ package serviceimport
 
 import (
 	"context"
+	"math"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
 
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
 	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober"
 	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
 	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/annotation"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/endpointslice"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/status"
 )
 
 type Reconciler struct {
@@ -38,17 +50,39 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 
 	if cleanup || svcImport.DeletionTimestamp != nil {
 		r.Controller.proberManager.RemoveServiceImport(req.NamespacedName.String())
+		if r.Controller.endpointSliceManager != nil {
+			r.Controller.endpointSliceManager.Remove(req.Name, req.Namespace)
+		}
 		return ctrl.Result{}, nil
 	}
 
+	policy, err := r.resolveProbePolicy(ctx, svcImport)
+	if err != nil {
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	targets, err := r.resolveTargets(ctx, svcImport)
+	if err != nil {
+		klog.ErrorS(err, "Can't resolve probe targets", "serviceImport", klog.KObj(svcImport))
+		return ctrl.Result{}, err
+	}
+	if len(targets.Invalid) > 0 {
+		err := utilerrors.NewAggregate(targets.Invalid)
+		klog.ErrorS(err, "Skipping invalid probe targets", "serviceImport", klog.KObj(svcImport))
+		r.Controller.recorder.Eventf(svcImport, corev1.EventTypeWarning, prober.InvalidAddress,
+			"Skipping invalid addresses, the other addresses are probed: %v", err)
+	}
+
 	// Add the prober for the new serviceImport.
 	if !r.Controller.proberManager.GetServiceImport(req.NamespacedName.String()) {
-		r.Controller.proberManager.AddServiceImport(svcImport)
+		if err := r.Controller.proberManager.AddServiceImport(svcImport, policy, targets); err != nil {
+			return ctrl.Result{}, err
+		}
 		return ctrl.Result{}, nil
 	}
 
 	// Update the prober for the serviceImport.
-	if err := r.Controller.proberManager.UpdateServiceImport(svcImport); err != nil {
+	if err := r.Controller.proberManager.UpdateServiceImport(svcImport, policy, targets); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -64,56 +98,198 @@ func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
 			return true
 		},
 		UpdateFunc: func(updateEvent event.UpdateEvent) bool {
-			return true
+			// The plugin updates its own annotations whenever the probe results change.
+			return !onlyOwnAnnotationsChanged(updateEvent.ObjectOld, updateEvent.ObjectNew)
 		},
 		GenericFunc: func(genericEvent event.GenericEvent) bool {
 			return false
 		},
 	},
 	)
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		Named("eps-probe").
-		For(&v1alpha1.ServiceImport{}, endpointSlicePredicate).
-		Complete(r)
+		For(&v1alpha1.ServiceImport{}, endpointSlicePredicate)
+	// Watching ProbePolicies requires the ProbePolicy CRD, the manager fails to start without it. Namespace
+	// labels only matter to the namespace selectors of ProbePolicies.
+	if r.Controller.enableProbePolicy {
+		b = b.Watches(&kosmosv1alpha1.ProbePolicy{}, handler.EnqueueRequestsFromMapFunc(r.serviceImportsForProbePolicy)).
+			Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.serviceImportsForNamespace),
+				builder.WithPredicates(predicate.LabelChangedPredicate{}))
+	}
+	if r.Controller.targetSource == prober.TargetSourceEndpointSlice {
+		b = b.Watches(&discoveryv1.EndpointSlice{}, handler.EnqueueRequestsFromMapFunc(r.serviceImportForEndpointSlice))
+	}
+	if r.Controller.restoreEndpointSlicesOnStart {
+		if err := mgr.Add(manager.RunnableFunc(r.Controller.restoreEndpointSlices)); err != nil {
+			return err
+		}
+	}
+	return b.Complete(r)
+}
+
+// ownAnnotations are the annotations the plugin publishes the probe results in.
+var ownAnnotations = []string{
+	annotation.ServiceImportNotReachableEPSAddr,
+	annotation.ServiceImportDegradedEPSAddr,
+	annotation.ServiceImportProbeStatus,
+}
+
+// onlyOwnAnnotationsChanged returns whether the objects differ in the annotations of the plugin only.
+func onlyOwnAnnotationsChanged(oldObj, newObj client.Object) bool {
+	oldSvcImport, ok := oldObj.(*v1alpha1.ServiceImport)
+	if !ok {
+		return false
+	}
+	newSvcImport, ok := newObj.(*v1alpha1.ServiceImport)
+	if !ok {
+		return false
+	}
+	return equality.Semantic.DeepEqual(withoutOwnAnnotations(oldSvcImport), withoutOwnAnnotations(newSvcImport))
+}
+
+// withoutOwnAnnotations returns a copy of the serviceImport without the annotations of the plugin and the
+// metadata changed by every update.
+func withoutOwnAnnotations(svcImport *v1alpha1.ServiceImport) *v1alpha1.ServiceImport {
+	svcImport = svcImport.DeepCopy()
+	for _, key := range ownAnnotations {
+		delete(svcImport.Annotations, key)
+	}
+	if len(svcImport.Annotations) == 0 {
+		svcImport.Annotations = nil
+	}
+	svcImport.ResourceVersion = ""
+	svcImport.ManagedFields = nil
+	return svcImport
 }
 
 type Controller struct {
 	client            client.Client
+	recorder          record.EventRecorder
 	proberManager     prober.Manager
 	resultsManager    results.Manager
 	annotationManager annotation.Manager
+	// statusManager is nil unless EndpointProbeStatuses are enabled.
+	statusManager status.Manager
+	// endpointSliceManager is nil unless marking EndpointSlice endpoints is enabled.
+	endpointSliceManager endpointslice.Manager
+	// targetSource is where the probed addresses of a serviceImport come from.
+	targetSource prober.TargetSource
+	// apiReader reads objects bypassing the cache of the client.
+	apiReader client.Reader
+	// enableProbePolicy applies the ProbePolicies selecting a serviceImport to its probe.
+	enableProbePolicy bool
+	// restoreEndpointSlicesOnStart restores the EndpointSlice endpoints marked not ready by a previous run.
+	restoreEndpointSlicesOnStart bool
 }
 
-func NewController(cli client.Client, periodSeconds, failureThreshold int) *Controller {
+// Options configures the controller.
+type Options struct {
+	// ProbeConcurrency is the maximum number of probes running at the same time across all serviceImports.
+	ProbeConcurrency int
+
+	// EnableProbePolicy applies the ProbePolicies selecting a serviceImport to its probe.
+	EnableProbePolicy bool
+
+	// EnableProbeStatus maintains an EndpointProbeStatus for every probed serviceImport.
+	EnableProbeStatus bool
+
+	// APIReader reads objects bypassing the cache of the client.
+	APIReader client.Reader
+
+	// MarkEndpointSlices marks the endpoints of unreachable addresses in the EndpointSlices of a
+	// serviceImport not ready.
+	MarkEndpointSlices bool
+
+	// RestoreEndpointSlices marks the endpoints marked not ready by a previous run ready again at startup,
+	// unless MarkEndpointSlices is set.
+	RestoreEndpointSlices bool
+
+	// TargetSource is where the probed addresses of a serviceImport come from, the kosmos.io/address
+	// annotation if empty.
+	TargetSource prober.TargetSource
+}
+
+func NewController(cli client.Client, recorder record.EventRecorder, spec prober.ProbeSpec, opts Options) *Controller {
 	resultsManager := results.NewManager()
-	return &Controller{
+	c := &Controller{
 		client:            cli,
+		recorder:          recorder,
 		resultsManager:    resultsManager,
-		proberManager:     prober.NewManager(resultsManager, periodSeconds, failureThreshold),
+		proberManager:     prober.NewManager(resultsManager, spec, opts.ProbeConcurrency, recorder),
 		annotationManager: annotation.NewManager(cli),
+		targetSource:      opts.TargetSource,
+		apiReader:         opts.APIReader,
+		enableProbePolicy: opts.EnableProbePolicy,
+	}
+	if opts.EnableProbeStatus {
+		c.statusManager = status.NewManager(cli, opts.APIReader)
 	}
+	if opts.MarkEndpointSlices {
+		c.endpointSliceManager = endpointslice.NewManager(cli)
+	} else {
+		c.restoreEndpointSlicesOnStart = opts.RestoreEndpointSlices
+	}
+	return c
 }
 
-const syncPeriod = 5 * time.Second
-
 func (c *Controller) Run(stopCh <-chan struct{}) {
 	defer runtime.HandleCrash()
 
 	klog.InfoS("Staring eps-probe controller")
 	defer klog.InfoS("Shutting down eps-probe controller")
 
-	go c.annotationManager.Start()
+	go c.annotationManager.Start(stopCh)
+	if c.statusManager != nil {
+		go c.statusManager.Start(stopCh)
+	}
+	if c.endpointSliceManager != nil {
+		go c.endpointSliceManager.Start(stopCh)
+	}
 
-	go wait.Until(c.syncLoop, syncPeriod, stopCh)
+	go wait.Until(c.syncLoop, time.Second, stopCh)
 
 	<-stopCh
+	c.resultsManager.ShutDown()
+}
+
+// restoreEndpointSlices restores the EndpointSlice endpoints marked not ready by a previous run which had
+// marking enabled, retrying until it succeeds or ctx is done. It gives up if the plugin may not update
+// EndpointSlices.
+func (c *Controller) restoreEndpointSlices(ctx context.Context) error {
+	backoff := wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: math.MaxInt32, Cap: 5 * time.Minute}
+	// It only fails once ctx is done, when the manager is stopping anyway.
+	_ = wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		if err := endpointslice.RestoreEndpointSlices(ctx, c.client, c.apiReader); err != nil {
+			// Without the permission to update EndpointSlices no run can have marked them.
+			if apierrors.IsForbidden(err) {
+				klog.ErrorS(err, "Not permitted to restore endpointSlices marked by a previous run, giving up")
+				return true, nil
+			}
+			klog.ErrorS(err, "Could not restore endpointSlices marked by a previous run, retrying")
+			return false, nil
+		}
+		klog.InfoS("Restored endpointSlices marked by a previous run")
+		return true, nil
+	})
+	return nil
 }
 
+// syncLoop consumes the probe results continuously until the results manager is shut down.
 func (c *Controller) syncLoop() {
-	select {
-	case update := <-c.resultsManager.Updates():
+	for {
+		update, ok := c.resultsManager.Pop()
+		if !ok {
+			return
+		}
 		klog.V(3).InfoS("Received results", "results", update)
-		c.annotationManager.Set("", update.Addresses, update.SvcImportName, update.Namespace)
-	default:
+		c.annotationManager.Set("", update.Addresses, update.DegradedAddresses, update.Statuses,
+			update.SvcImportName, update.Namespace)
+		if c.statusManager != nil {
+			c.statusManager.Set(update)
+		}
+		if c.endpointSliceManager != nil {
+			c.endpointSliceManager.Set(update.Addresses, update.SvcImportName, update.Namespace)
+		}
+		metrics.ResultsUpdateLatency.Observe(time.Since(update.Timestamp).Seconds())
 	}
 }
@@ -0,0 +1,109 @@
+package serviceimport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/annotation"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/endpointslice"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/util/fakeclient"
+)
+
+func TestOnlyOwnAnnotationsChanged(t *testing.T) {
+	old := &v1alpha1.ServiceImport{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "svc",
+			Namespace:       "ns",
+			ResourceVersion: "1",
+			Annotations:     map[string]string{"kosmos.io/address": "10.0.0.1,10.0.0.2"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		update func(svcImport *v1alpha1.ServiceImport)
+		want   bool
+	}{
+		{
+			name: "own annotations",
+			update: func(svcImport *v1alpha1.ServiceImport) {
+				svcImport.Annotations[annotation.ServiceImportNotReachableEPSAddr] = "10.0.0.2"
+				svcImport.Annotations[annotation.ServiceImportProbeStatus] = `{"addresses":[]}`
+			},
+			want: true,
+		},
+		{
+			name: "probed addresses",
+			update: func(svcImport *v1alpha1.ServiceImport) {
+				svcImport.Annotations["kosmos.io/address"] = "10.0.0.1"
+			},
+			want: false,
+		},
+		{
+			name: "labels",
+			update: func(svcImport *v1alpha1.ServiceImport) {
+				svcImport.Labels = map[string]string{"app": "web"}
+			},
+			want: false,
+		},
+		{
+			name: "spec",
+			update: func(svcImport *v1alpha1.ServiceImport) {
+				svcImport.Spec.Ports = []v1alpha1.ServicePort{{Protocol: "TCP", Port: 80}}
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := old.DeepCopy()
+			updated.ResourceVersion = "2"
+			tt.update(updated)
+			if got := onlyOwnAnnotationsChanged(old, updated); got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRestoreEndpointSlicesGivesUpWhenForbidden(t *testing.T) {
+	notReady := false
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "svc-1",
+			Namespace:   "ns",
+			Labels:      map[string]string{v1alpha1.LabelServiceName: "svc"},
+			Annotations: map[string]string{endpointslice.NotReadyAddresses: "10.0.0.1"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+		},
+	}
+	patches := 0
+	cli := interceptor.NewClient(fakeclient.NewClient(slice), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches++
+			return apierrors.NewForbidden(discoveryv1.Resource("endpointslices"), obj.GetName(), errors.New("no patch permission"))
+		},
+	})
+	c := &Controller{client: cli, apiReader: cli}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.restoreEndpointSlices(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil || patches != 1 {
+		t.Errorf("expected the forbidden restore not to be retried, got %d patches", patches)
+	}
+}
@@ -0,0 +1,253 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/metrics"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/serviceimport/syncer"
+)
+
+// Manager maintains an EndpointProbeStatus for every probed serviceImport.
+type Manager interface {
+	// Start syncs the desired EndpointProbeStatuses with the apiserver until stopCh is closed.
+	Start(stopCh <-chan struct{})
+
+	// Set records the desired probe status of the serviceImport of the update and queues a sync.
+	Set(update results.Update)
+
+	syncStatus(key types.NamespacedName, update results.Update) (bool, error)
+}
+
+type manager struct {
+	client client.Client
+	// apiReader reads from the apiserver, bypassing the cache of the client
+	apiReader client.Reader
+
+	// syncer syncs the latest probe results of every serviceImport
+	syncer *syncer.Syncer[results.Update]
+}
+
+// NewManager creates a Manager writing EndpointProbeStatuses with the client. The apiReader reads
+// EndpointProbeStatuses the cache of the client has not observed yet.
+func NewManager(client client.Client, apiReader client.Reader) Manager {
+	m := &manager{client: client, apiReader: apiReader}
+	m.syncer = syncer.New[results.Update]("probe-status", syncPeriod, m.syncStatus)
+	return m
+}
+
+// syncPeriod is how often every desired EndpointProbeStatus is synced again, recreating deleted objects.
+// EndpointProbeStatuses are read from the informer cache, so a resync without changes does not reach the apiserver.
+const syncPeriod = 30 * time.Second
+
+func (m *manager) Start(stopCh <-chan struct{}) {
+	if m.client == nil {
+		klog.InfoS("kubernetes client is nil, not starting probe status manager")
+		return
+	}
+
+	klog.InfoS("Starting to sync endpointProbeStatus with apiserver")
+	m.syncer.Run(stopCh)
+}
+
+func (m *manager) Set(update results.Update) {
+	key := types.NamespacedName{Namespace: update.Namespace, Name: update.SvcImportName}
+	klog.V(3).InfoS("Probe status manager: queueing endpointProbeStatus sync", "serviceImport", key)
+	m.syncer.Set(key, update)
+}
+
+// syncStatus writes the EndpointProbeStatus of the serviceImport. It is done once the serviceImport has
+// been deleted.
+func (m *manager) syncStatus(key types.NamespacedName, update results.Update) (bool, error) {
+	svcImport := &v1alpha1.ServiceImport{}
+	if err := m.client.Get(context.TODO(), key, svcImport); err != nil {
+		if apierrors.IsNotFound(err) {
+			klog.V(3).InfoS("ServiceImport not found, dropping desired endpointProbeStatus", "serviceImport", key)
+			return true, nil
+		}
+		return false, err
+	}
+
+	// The EndpointProbeStatus is garbage collected together with the serviceImport.
+	if svcImport.DeletionTimestamp != nil {
+		return false, nil
+	}
+
+	probeStatus := &kosmosv1alpha1.EndpointProbeStatus{}
+	err := m.client.Get(context.TODO(), key, probeStatus)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	exists := err == nil
+
+	status := *probeStatus.Status.DeepCopy()
+	setStatus(&status, update)
+	if exists && equality.Semantic.DeepEqual(status, probeStatus.Status) {
+		return false, nil
+	}
+	probeStatus.Status = status
+
+	start := time.Now()
+	if exists {
+		err = m.client.Update(context.TODO(), probeStatus, client.FieldOwner(FieldManager))
+	} else {
+		probeStatus.Namespace = key.Namespace
+		probeStatus.Name = key.Name
+		probeStatus.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(svcImport, v1alpha1.SchemeGroupVersion.WithKind("ServiceImport")),
+		}
+		err = m.client.Create(context.TODO(), probeStatus, client.FieldOwner(FieldManager))
+		if apierrors.IsAlreadyExists(err) {
+			// The cache has not observed the EndpointProbeStatus created by a previous sync yet.
+			err = m.updateUncached(key, update)
+		}
+	}
+	metrics.StatusWriteDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.StatusWrites.WithLabelValues("failure").Inc()
+		return false, err
+	}
+	metrics.StatusWrites.WithLabelValues("success").Inc()
+	klog.V(3).InfoS("Success to sync endpointProbeStatus", "serviceImport", klog.KObj(svcImport), "created", !exists)
+	return false, nil
+}
+
+// updateUncached updates the EndpointProbeStatus read from the apiserver, unless its status is up to date.
+func (m *manager) updateUncached(key types.NamespacedName, update results.Update) error {
+	probeStatus := &kosmosv1alpha1.EndpointProbeStatus{}
+	if err := m.apiReader.Get(context.TODO(), key, probeStatus); err != nil {
+		return err
+	}
+
+	status := *probeStatus.Status.DeepCopy()
+	setStatus(&status, update)
+	if equality.Semantic.DeepEqual(status, probeStatus.Status) {
+		return nil
+	}
+	probeStatus.Status = status
+	return m.client.Update(context.TODO(), probeStatus, client.FieldOwner(FieldManager))
+}
+
+// FieldManager is the field manager of the EndpointProbeStatuses written by the plugin.
+const FieldManager = "eps-probe-plugin"
+
+const (
+	reasonAllReachable          = "AllAddressesReachable"
+	reasonSomeUnreachable       = "SomeAddressesUnreachable"
+	reasonAllUnreachable        = "AllAddressesUnreachable"
+	reasonNoAddressesProbed     = "NoAddressesProbed"
+	reasonAddressesDegraded     = "AddressesDegraded"
+	reasonUnreachableSuppressed = "UnreachableAddressesSuppressed"
+)
+
+// setStatus sets the conditions and address statuses of status from the probe results. Conditions keep
+// their transition time unless their status changes.
+func setStatus(status *kosmosv1alpha1.EndpointProbeStatusStatus, update results.Update) {
+	status.UnreachableAddresses = nil
+	if len(update.Addresses) > 0 {
+		status.UnreachableAddresses = append([]string{}, update.Addresses...)
+	}
+	status.DegradedAddresses = nil
+	if len(update.DegradedAddresses) > 0 {
+		status.DegradedAddresses = append([]string{}, update.DegradedAddresses...)
+	}
+	status.Addresses = nil
+	for _, s := range update.Statuses {
+		status.Addresses = append(status.Addresses, convertAddressStatus(s))
+	}
+
+	probed, unreachable := len(update.Statuses), len(update.Addresses)
+	allReachable := metav1.Condition{
+		Type:    kosmosv1alpha1.EndpointProbeStatusAllReachable,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonAllReachable,
+		Message: fmt.Sprintf("All %d probed addresses are reachable", probed),
+	}
+	degraded := metav1.Condition{
+		Type:    kosmosv1alpha1.EndpointProbeStatusDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  reasonAllReachable,
+		Message: allReachable.Message,
+	}
+	switch {
+	case probed == 0:
+		allReachable.Reason, degraded.Reason = reasonNoAddressesProbed, reasonNoAddressesProbed
+		allReachable.Message, degraded.Message = "No address is probed", "No address is probed"
+	case unreachable >= probed:
+		allReachable.Status = metav1.ConditionFalse
+		allReachable.Reason, degraded.Reason = reasonAllUnreachable, reasonAllUnreachable
+		allReachable.Message = fmt.Sprintf("All %d probed addresses are unreachable", probed)
+		degraded.Message = allReachable.Message
+	case unreachable > 0:
+		allReachable.Status, degraded.Status = metav1.ConditionFalse, metav1.ConditionTrue
+		allReachable.Reason, degraded.Reason = reasonSomeUnreachable, reasonSomeUnreachable
+		allReachable.Message = fmt.Sprintf("%d of %d probed addresses are unreachable", unreachable, probed)
+		degraded.Message = allReachable.Message
+	case len(update.DegradedAddresses) > 0:
+		degraded.Status, degraded.Reason = metav1.ConditionTrue, reasonAddressesDegraded
+		degraded.Message = fmt.Sprintf("%d of %d probed addresses exceed the latency or loss budget",
+			len(update.DegradedAddresses), probed)
+	}
+	if suppressed := countSuppressed(update.Statuses); suppressed > 0 {
+		allReachable.Status, allReachable.Reason = metav1.ConditionFalse, reasonUnreachableSuppressed
+		allReachable.Message = fmt.Sprintf("%d of %d probed addresses are unreachable, %d of them are not published "+
+			"as too many addresses are unreachable", unreachable+suppressed, probed, suppressed)
+	}
+	meta.SetStatusCondition(&status.Conditions, allReachable)
+	meta.SetStatusCondition(&status.Conditions, degraded)
+}
+
+func countSuppressed(statuses []results.AddressStatus) int {
+	n := 0
+	for _, s := range statuses {
+		if s.Suppressed {
+			n++
+		}
+	}
+	return n
+}
+
+// convertAddressStatus converts an address status of the results manager to its API representation.
+// Times are truncated to seconds, as they are serialized, so unchanged statuses compare equal.
+func convertAddressStatus(s results.AddressStatus) kosmosv1alpha1.AddressProbeStatus {
+	status := kosmosv1alpha1.AddressProbeStatus{
+		Address:              s.Address,
+		Reachable:            s.Reachable,
+		Suppressed:           s.Suppressed,
+		Degraded:             s.Degraded,
+		LastResult:           s.LastResult,
+		ConsecutiveSuccesses: int32(s.ConsecutiveSuccesses),
+		ConsecutiveFailures:  int32(s.ConsecutiveFailures),
+		LastRTT:              s.LastRTT,
+		Reason:               s.Reason,
+	}
+	if s.LastTransitionTime != nil {
+		t := s.LastTransitionTime.Rfc3339Copy()
+		status.LastTransitionTime = &t
+	}
+	if s.LastDegradedTransitionTime != nil {
+		t := s.LastDegradedTransitionTime.Rfc3339Copy()
+		status.LastDegradedTransitionTime = &t
+	}
+	if s.LastProbeTime != nil {
+		t := s.LastProbeTime.Rfc3339Copy()
+		status.LastProbeTime = &t
+	}
+	if s.PacketLossPercent != nil {
+		loss := int32(*s.PacketLossPercent)
+		status.PacketLossPercent = &loss
+	}
+	return status
+}
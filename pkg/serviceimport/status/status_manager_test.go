@@ -0,0 +1,64 @@
+package status
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	kosmosv1alpha1 "github.com/kosmos.io/eps-probe-plugin/pkg/apis/kosmos/v1alpha1"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober/results"
+	"github.com/kosmos.io/eps-probe-plugin/pkg/util/fakeclient"
+)
+
+func TestSyncStatusUpdatesStatusMissingFromCache(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "svc"}
+	svcImport := &v1alpha1.ServiceImport{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace, UID: "uid"}}
+	// The EndpointProbeStatus was created by a previous sync, which the cache has not observed yet.
+	probeStatus := &kosmosv1alpha1.EndpointProbeStatus{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	apiReader := fakeclient.NewClient(svcImport, probeStatus)
+
+	updates := 0
+	cli := interceptor.NewClient(apiReader, interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, ok := obj.(*kosmosv1alpha1.EndpointProbeStatus); ok {
+				return apierrors.NewNotFound(kosmosv1alpha1.Resource("endpointprobestatuses"), key.Name)
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			updates++
+			return c.Update(ctx, obj, opts...)
+		},
+	})
+	m := NewManager(cli, apiReader).(*manager)
+
+	m.Set(results.Update{
+		Addresses:     []string{"10.0.0.2"},
+		Result:        results.Failure,
+		SvcImportName: key.Name,
+		Namespace:     key.Namespace,
+		Statuses:      []results.AddressStatus{{Address: "10.0.0.1", Reachable: true}, {Address: "10.0.0.2"}},
+	})
+	for i := 0; i < 2; i++ {
+		if err := m.syncer.Sync(key); err != nil {
+			t.Fatalf("sync %d: %v", i+1, err)
+		}
+	}
+	if updates != 1 {
+		t.Errorf("expected one update of the existing endpointProbeStatus, got %d", updates)
+	}
+
+	got := &kosmosv1alpha1.EndpointProbeStatus{}
+	if err := apiReader.Get(context.TODO(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Status.UnreachableAddresses) != 1 || got.Status.UnreachableAddresses[0] != "10.0.0.2" {
+		t.Errorf("expected 10.0.0.2 to be unreachable, got %v", got.Status.UnreachableAddresses)
+	}
+}
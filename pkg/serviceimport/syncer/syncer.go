@@ -0,0 +1,124 @@
+package syncer
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// SyncFunc syncs the desired state of the serviceImport with the apiserver. It returns done once the
+// desired state no longer has to be synced, e.g. because the serviceImport has been deleted.
+type SyncFunc[T any] func(key types.NamespacedName, desired T) (done bool, err error)
+
+// Syncer syncs the latest desired state of every serviceImport with the apiserver. Pending syncs of the
+// same serviceImport are deduplicated, failed syncs are retried with exponential backoff and every
+// desired state is synced again periodically, repairing changes made by others.
+type Syncer[T any] struct {
+	name   string
+	period time.Duration
+	sync   SyncFunc[T]
+
+	// guards desired
+	lock sync.RWMutex
+	// map of serviceImport -> desired state
+	desired map[types.NamespacedName]T
+
+	// queue of serviceImports whose desired state has to be synced
+	queue workqueue.RateLimitingInterface
+}
+
+// New creates a Syncer calling sync for the serviceImports whose desired state has been set, and for all
+// of them every period. The name identifies the syncer in logs and workqueue metrics.
+func New[T any](name string, period time.Duration, sync SyncFunc[T]) *Syncer[T] {
+	return &Syncer[T]{
+		name:    name,
+		period:  period,
+		sync:    sync,
+		desired: make(map[types.NamespacedName]T),
+		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), name),
+	}
+}
+
+// Run syncs the desired states until stopCh is closed.
+func (s *Syncer[T]) Run(stopCh <-chan struct{}) {
+	defer s.queue.ShutDown()
+
+	go wait.Until(s.worker, time.Second, stopCh)
+	go wait.Until(s.resync, s.period, stopCh)
+
+	<-stopCh
+}
+
+// Set records the desired state of the serviceImport and queues a sync.
+func (s *Syncer[T]) Set(key types.NamespacedName, desired T) {
+	s.lock.Lock()
+	s.desired[key] = desired
+	s.lock.Unlock()
+
+	s.queue.Add(key)
+}
+
+// Get returns the desired state of the serviceImport.
+func (s *Syncer[T]) Get(key types.NamespacedName) (T, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	desired, ok := s.desired[key]
+	return desired, ok
+}
+
+// Sync syncs the desired state of the serviceImport once. A desired state whose sync is done is dropped,
+// unless it has been set again meanwhile.
+func (s *Syncer[T]) Sync(key types.NamespacedName) error {
+	desired, ok := s.Get(key)
+	if !ok {
+		return nil
+	}
+	done, err := s.sync(key, desired)
+	if err != nil || !done {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if current, ok := s.desired[key]; ok && reflect.DeepEqual(current, desired) {
+		delete(s.desired, key)
+	}
+	return nil
+}
+
+// resync queues every desired state.
+func (s *Syncer[T]) resync() {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for key := range s.desired {
+		s.queue.Add(key)
+	}
+}
+
+func (s *Syncer[T]) worker() {
+	for s.processNextItem() {
+	}
+}
+
+func (s *Syncer[T]) processNextItem() bool {
+	item, shutdown := s.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer s.queue.Done(item)
+
+	key := item.(types.NamespacedName)
+	if err := s.Sync(key); err != nil {
+		klog.ErrorS(err, "Could not sync, retrying", "syncer", s.name, "serviceImport", key,
+			"retries", s.queue.NumRequeues(key))
+		s.queue.AddRateLimited(key)
+		return true
+	}
+	s.queue.Forget(key)
+	return true
+}
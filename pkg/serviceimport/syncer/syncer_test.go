@@ -0,0 +1,79 @@
+package syncer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSyncDropsDoneDesiredState(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "svc"}
+	var s *Syncer[string]
+	s = New[string]("test", time.Minute, func(key types.NamespacedName, desired string) (bool, error) {
+		// The desired state is set again while it is synced.
+		if desired == "racing" {
+			s.Set(key, "changed")
+		}
+		return true, nil
+	})
+	defer s.queue.ShutDown()
+
+	// Nothing is synced without a desired state.
+	if err := s.Sync(key); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Set(key, "done")
+	if err := s.Sync(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get(key); ok {
+		t.Errorf("expected the desired state to be dropped once its sync is done")
+	}
+
+	s.Set(key, "racing")
+	if err := s.Sync(key); err != nil {
+		t.Fatal(err)
+	}
+	if desired, ok := s.Get(key); !ok || desired != "changed" {
+		t.Errorf("expected the desired state set meanwhile to be kept, got %q", desired)
+	}
+}
+
+func TestProcessNextItemRetriesFailedSync(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "svc"}
+	failures := 1
+	s := New[string]("test", time.Minute, func(types.NamespacedName, string) (bool, error) {
+		if failures > 0 {
+			failures--
+			return false, errors.New("conflict")
+		}
+		return false, nil
+	})
+	defer s.queue.ShutDown()
+
+	s.Set(key, "desired")
+	s.Set(key, "desired")
+	if s.queue.Len() != 1 {
+		t.Fatalf("expected pending syncs of the same serviceImport to be deduplicated, got %d", s.queue.Len())
+	}
+	s.processNextItem()
+	if s.queue.NumRequeues(key) != 1 {
+		t.Fatalf("expected the failed sync to be retried, got %d requeues", s.queue.NumRequeues(key))
+	}
+	// The retry is rate limited, it is added back to the queue after a short backoff.
+	s.processNextItem()
+	if s.queue.NumRequeues(key) != 0 {
+		t.Errorf("expected the successful sync to reset the backoff, got %d requeues", s.queue.NumRequeues(key))
+	}
+	if _, ok := s.Get(key); !ok {
+		t.Errorf("expected the desired state to be kept until its sync is done")
+	}
+
+	s.resync()
+	if s.queue.Len() != 1 {
+		t.Errorf("expected the resync to queue the desired state, got %d", s.queue.Len())
+	}
+}
@@ -0,0 +1,35 @@
+package serviceimport
+
+import (
+	"context"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/mcs-api/pkg/apis/v1alpha1"
+
+	"github.com/kosmos.io/eps-probe-plugin/pkg/endpointslice/prober"
+)
+
+// resolveTargets returns the addresses to probe for the serviceImport from the configured target source.
+func (r *Reconciler) resolveTargets(ctx context.Context, svcImport *v1alpha1.ServiceImport) (*prober.Targets, error) {
+	if r.Controller.targetSource != prober.TargetSourceEndpointSlice {
+		return prober.AnnotationTargets(svcImport), nil
+	}
+
+	slices := &discoveryv1.EndpointSliceList{}
+	if err := r.Controller.client.List(ctx, slices, client.InNamespace(svcImport.Namespace),
+		client.MatchingLabels{v1alpha1.LabelServiceName: svcImport.Name}); err != nil {
+		return nil, err
+	}
+	return prober.EndpointSliceTargets(slices.Items), nil
+}
+
+// serviceImportForEndpointSlice enqueues the serviceImport an EndpointSlice belongs to.
+func (r *Reconciler) serviceImportForEndpointSlice(_ context.Context, obj client.Object) []reconcile.Request {
+	name, ok := obj.GetLabels()[v1alpha1.LabelServiceName]
+	if !ok || name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}}}
+}
@@ -2,20 +2,28 @@ package util
 
 import (
 	"fmt"
-	"net/url"
+	"net"
 	"strings"
 )
 
-func ConvertStringToAddresses(ips string) ([]string, error) {
+// ConvertStringToAddresses splits a comma separated address list, ignoring surrounding spaces and empty entries.
+// Entries which aren't IP addresses are skipped and returned as errors, so a single bad entry doesn't hide the others.
+func ConvertStringToAddresses(ips string) ([]string, []error) {
 	arr := strings.Split(ips, ",")
 
 	var returned []string
+	var errs []error
 	for _, i := range arr {
-		if _, err := url.Parse(i); err != nil {
-			return nil, fmt.Errorf("error to parse ip: %s", i)
+		i = strings.TrimSpace(i)
+		if i == "" {
+			continue
+		}
+		if net.ParseIP(i) == nil {
+			errs = append(errs, fmt.Errorf("error to parse ip: %s", i))
+			continue
 		}
 		returned = append(returned, i)
 	}
 
-	return returned, nil
+	return returned, errs
 }
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertStringToAddresses(t *testing.T) {
+	tests := []struct {
+		name        string
+		ips         string
+		want        []string
+		wantInvalid int
+	}{
+		{name: "empty", ips: "", want: nil},
+		{name: "single", ips: "10.0.0.1", want: []string{"10.0.0.1"}},
+		{name: "spaces and empty entries", ips: " 10.0.0.1, ,10.0.0.2,", want: []string{"10.0.0.1", "10.0.0.2"}},
+		{name: "ipv6", ips: "fd00::1,10.0.0.1", want: []string{"fd00::1", "10.0.0.1"}},
+		{name: "invalid only", ips: "10.0.0.%zz", want: nil, wantInvalid: 1},
+		{name: "mixed", ips: "10.0.0.1,10.0.0.%zz, 10.0.0.2 ,%gg", want: []string{"10.0.0.1", "10.0.0.2"}, wantInvalid: 2},
+		{name: "hostname", ips: "example.com,10.0.0.1", want: []string{"10.0.0.1"}, wantInvalid: 1},
+		{name: "out of range octet", ips: "10.0.0.256", want: nil, wantInvalid: 1},
+		{name: "cidr", ips: "10.0.0.0/24", want: nil, wantInvalid: 1},
+		{name: "port", ips: "10.0.0.1:80", want: nil, wantInvalid: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := ConvertStringToAddresses(tt.ips)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConvertStringToAddresses(%q) = %v, want %v", tt.ips, got, tt.want)
+			}
+			if len(errs) != tt.wantInvalid {
+				t.Errorf("ConvertStringToAddresses(%q) returned %d errors %v, want %d", tt.ips, len(errs), errs, tt.wantInvalid)
+			}
+		})
+	}
+}